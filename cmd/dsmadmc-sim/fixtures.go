@@ -0,0 +1,111 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+var (
+	selectLiteral = regexp.MustCompile(`(?i)^SELECT\s+'([^']*)'\s+FROM\s+\S+$`)
+	whitespace    = regexp.MustCompile(`\s+`)
+)
+
+// fixture is the response to a query, matched by exact query text or regex
+type fixture struct {
+	Query      string        `yaml:"query"`
+	Regex      string        `yaml:"regex"`
+	Servername string        `yaml:"servername"`
+	Stdout     string        `yaml:"stdout"`
+	Stderr     string        `yaml:"stderr"`
+	ExitCode   int           `yaml:"exit_code"`
+	Delay      time.Duration `yaml:"delay"`
+	NoMatch    bool          `yaml:"no_match"`
+	Error      string        `yaml:"error"`
+	regex      *regexp.Regexp
+	file       string
+}
+
+// loadFixtures reads all YAML fixtures in dir, sorted by file name
+func loadFixtures(dir string) ([]*fixture, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("%s must be set to the fixtures directory", fixturesEnv)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	var fixtures []*fixture
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		f := &fixture{file: file}
+		if err := yaml.Unmarshal(data, f); err != nil {
+			return nil, fmt.Errorf("Error parsing fixture %s: %s", file, err)
+		}
+		if f.Query == "" && f.Regex == "" {
+			return nil, fmt.Errorf("Fixture %s must define 'query' or 'regex'", file)
+		}
+		if f.Regex != "" {
+			f.regex, err = regexp.Compile("(?i)" + f.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("Error parsing fixture %s regex: %s", file, err)
+			}
+		}
+		fixtures = append(fixtures, f)
+	}
+	return fixtures, nil
+}
+
+func normalizeQuery(query string) string {
+	return strings.ToUpper(whitespace.ReplaceAllString(strings.TrimSpace(query), " "))
+}
+
+// matchFixture returns the fixture for a query, fixtures for the specific servername are preferred
+// over fixtures for any server and exact query matches are preferred over regex matches
+func matchFixture(fixtures []*fixture, query string, servername string) *fixture {
+	normalized := normalizeQuery(query)
+	var match *fixture
+	best := 0
+	for _, f := range fixtures {
+		if f.Servername != "" && !strings.EqualFold(f.Servername, servername) {
+			continue
+		}
+		score := 0
+		if f.Query != "" && normalizeQuery(f.Query) == normalized {
+			score = 2
+		} else if f.regex != nil && f.regex.MatchString(query) {
+			score = 1
+		}
+		if score > 0 && f.Servername != "" {
+			score += 2
+		}
+		if score > best {
+			match = f
+			best = score
+		}
+	}
+	return match
+}
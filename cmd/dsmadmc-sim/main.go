@@ -0,0 +1,240 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// dsmadmc-sim simulates the dsmadmc administrative client for testing tsm_exporter without a TSM server.
+// Queries are answered from the fixture files in the directory defined by DSMADMC_SIM_FIXTURES.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	fixturesEnv = "DSMADMC_SIM_FIXTURES"
+	idEnv       = "DSMADMC_SIM_ID"
+	passwordEnv = "DSMADMC_SIM_PASSWORD"
+)
+
+type option struct {
+	name    string
+	minimum int
+	value   bool
+}
+
+// options are the dsmadmc command line options, which may be abbreviated to the minimum length
+var options = []option{
+	{name: "SERVERNAME", minimum: 7, value: true},
+	{name: "ID", minimum: 2, value: true},
+	{name: "PASSWORD", minimum: 2, value: true},
+	{name: "DATAONLY", minimum: 8, value: true},
+	{name: "COMMADELIMITED", minimum: 5},
+	{name: "TABDELIMITED", minimum: 3},
+	{name: "DISPLAYMODE", minimum: 5, value: true},
+	{name: "OUTFILE", minimum: 3, value: true},
+	{name: "NOCONFIRM", minimum: 3},
+	{name: "CONSOLEMODE", minimum: 3},
+	{name: "MOUNTMODE", minimum: 5},
+	{name: "ITEMCOMMIT", minimum: 4},
+	{name: "ALWAYSPROMPT", minimum: 6},
+	{name: "NEWLINEAFTERPROMPT", minimum: 7},
+	{name: "OPTFILE", minimum: 4, value: true},
+	{name: "QUIET", minimum: 1},
+}
+
+type session struct {
+	options  map[string]string
+	command  string
+	fixtures []*fixture
+	stdin    *bufio.Reader
+	stdout   io.Writer
+	stderr   io.Writer
+	errorLog string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	s := &session{
+		options: make(map[string]string),
+		stdin:   bufio.NewReader(stdin),
+		stdout:  stdout,
+		stderr:  stderr,
+	}
+	var command []string
+	for i, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			command = append(command, arg)
+			continue
+		}
+		name, value, _ := strings.Cut(strings.TrimPrefix(arg, "-"), "=")
+		opt, ok := parseOption(name)
+		if !ok || (opt.value && value == "") {
+			fmt.Fprintf(stdout, "ANS8017E Command line parameter %d: '%s' is not valid.\n", i+1, arg)
+			return 3
+		}
+		s.options[opt.name] = value
+	}
+	s.command = strings.TrimSpace(strings.Join(command, " "))
+
+	logDir := os.Getenv("DSM_LOG")
+	if logDir == "" {
+		logDir = "."
+	}
+	s.errorLog = filepath.Join(logDir, "dsmerror.log")
+	f, err := os.OpenFile(s.errorLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintf(stdout, "ANS1398E Initialization functions cannot open one of the IBM Spectrum Protect logs or a related file: %s. errno = 13, %s\n", s.errorLog, err)
+		return 12
+	}
+	f.Close()
+
+	fixtures, err := loadFixtures(os.Getenv(fixturesEnv))
+	if err != nil {
+		fmt.Fprintf(stderr, "dsmadmc-sim: %s\n", err)
+		return 1
+	}
+	s.fixtures = fixtures
+
+	if !strings.EqualFold(s.options["DATAONLY"], "YES") {
+		s.banner()
+	}
+	if rc := s.login(); rc != 0 {
+		return rc
+	}
+	if s.command == "" {
+		return s.console()
+	}
+	return s.execute(s.command, true)
+}
+
+func parseOption(name string) (option, bool) {
+	name = strings.ToUpper(name)
+	for _, opt := range options {
+		if len(name) >= opt.minimum && strings.HasPrefix(opt.name, name) {
+			return opt, true
+		}
+	}
+	return option{}, false
+}
+
+func (s *session) servername() string {
+	return strings.ToUpper(s.options["SERVERNAME"])
+}
+
+func (s *session) banner() {
+	fmt.Fprintf(s.stdout, "IBM Spectrum Protect\nCommand Line Administrative Interface - Version 8, Release 1, Level 2.0\n\n")
+	fmt.Fprintf(s.stdout, "Session established with server %s: Linux/x86_64\n\n", s.servername())
+}
+
+func (s *session) prompt(prompt string) string {
+	fmt.Fprintf(s.stdout, "%s", prompt)
+	line, _ := s.stdin.ReadString('\n')
+	return strings.TrimRight(line, "\r\n")
+}
+
+// login checks credentials against DSMADMC_SIM_ID and DSMADMC_SIM_PASSWORD, prompting for any not passed as options
+func (s *session) login() int {
+	expectedID := os.Getenv(idEnv)
+	expectedPassword := os.Getenv(passwordEnv)
+	if expectedID == "" && expectedPassword == "" {
+		return 0
+	}
+	id, ok := s.options["ID"]
+	if !ok {
+		id = s.prompt("Enter your user id:  ")
+	}
+	password, ok := s.options["PASSWORD"]
+	if !ok {
+		password = s.prompt("Enter your password:  ")
+		fmt.Fprintln(s.stdout)
+	}
+	if !strings.EqualFold(id, expectedID) || password != expectedPassword {
+		s.logError("ANS8034E Your administrator ID is not recognized by this server.")
+		return 3
+	}
+	return 0
+}
+
+// console runs commands read from stdin like a dsmadmc console session
+func (s *session) console() int {
+	for {
+		fmt.Fprintf(s.stdout, "Protect: %s> ", s.servername())
+		line, err := s.stdin.ReadString('\n')
+		if err != nil {
+			return 0
+		}
+		command := strings.TrimSpace(line)
+		if command == "" {
+			continue
+		}
+		if strings.EqualFold(command, "quit") {
+			return 0
+		}
+		s.execute(command, false)
+	}
+}
+
+// execute answers a command and returns the dsmadmc return code
+func (s *session) execute(command string, batch bool) int {
+	if literal := selectLiteral.FindStringSubmatch(command); literal != nil {
+		fmt.Fprintln(s.stdout, literal[1])
+		return 0
+	}
+	fixture := matchFixture(s.fixtures, command, s.servername())
+	if fixture == nil {
+		fmt.Fprintf(s.stderr, "dsmadmc-sim: no fixture matches command: %s\n", command)
+		s.logError(fmt.Sprintf("ANR2000E Unknown command - %s.", strings.Fields(command)[0]))
+		return 3
+	}
+	if fixture.Delay > 0 {
+		time.Sleep(fixture.Delay)
+	}
+	fmt.Fprint(s.stdout, fixture.Stdout)
+	fmt.Fprint(s.stderr, fixture.Stderr)
+	rc := fixture.ExitCode
+	if fixture.NoMatch {
+		fmt.Fprintln(s.stdout, "ANR2034E SELECT: No match found using this criteria.")
+		if rc == 0 {
+			rc = 11
+		}
+	}
+	if fixture.Error != "" {
+		s.logError(fixture.Error)
+		if rc == 0 {
+			rc = 3
+		}
+	}
+	if batch && rc != 0 {
+		fmt.Fprintf(s.stdout, "ANS8001I Return code %d.\n", rc)
+	}
+	return rc
+}
+
+// logError prints a message and records it in dsmerror.log within DSM_LOG
+func (s *session) logError(message string) {
+	fmt.Fprintln(s.stdout, message)
+	f, err := os.OpenFile(s.errorLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%s %s\n", time.Now().Format("01/02/2006 15:04:05"), message)
+}
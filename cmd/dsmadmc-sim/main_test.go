@@ -0,0 +1,189 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupSim(t *testing.T) string {
+	logDir := t.TempDir()
+	t.Setenv(fixturesEnv, "fixtures")
+	t.Setenv("DSM_LOG", logDir)
+	return logDir
+}
+
+func runSim(args []string, stdin string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	rc := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return rc, stdout.String(), stderr.String()
+}
+
+func TestRunQuery(t *testing.T) {
+	setupSim(t)
+	rc, out, _ := runSim([]string{"-SERVERName=TSM1", "-ID=admin", "-PAssword=secret", "-DATAONLY=YES", "-COMMAdelimited", "SELECT FREE,TOTAL,USED FROM log"}, "")
+	if rc != 0 {
+		t.Errorf("Unexpected return code %d", rc)
+	}
+	if out != "32426.00,32768.00,342.00\n" {
+		t.Errorf("Unexpected out: %q", out)
+	}
+}
+
+func TestRunExactQuery(t *testing.T) {
+	setupSim(t)
+	rc, out, _ := runSim([]string{"-servern=TSM1", "-dataonly=yes", "query   status"}, "")
+	if rc != 0 {
+		t.Errorf("Unexpected return code %d", rc)
+	}
+	if !strings.HasPrefix(out, "SP03,") {
+		t.Errorf("Unexpected out: %q", out)
+	}
+}
+
+func TestRunBanner(t *testing.T) {
+	setupSim(t)
+	_, out, _ := runSim([]string{"-SERVERName=TSM1", "QUERY STATUS"}, "")
+	if !strings.Contains(out, "Session established with server TSM1") {
+		t.Errorf("Unexpected out: %q", out)
+	}
+}
+
+func TestRunInvalidOption(t *testing.T) {
+	setupSim(t)
+	rc, out, _ := runSim([]string{"-FOO=bar", "QUERY STATUS"}, "")
+	if rc != 3 {
+		t.Errorf("Unexpected return code %d", rc)
+	}
+	if !strings.Contains(out, "ANS8017E") {
+		t.Errorf("Unexpected out: %q", out)
+	}
+}
+
+func TestRunNoMatch(t *testing.T) {
+	setupSim(t)
+	rc, out, _ := runSim([]string{"-SERVERName=SIMNOMATCH", "-DATAONLY=YES", "QUERY STATUS"}, "")
+	if rc != 11 {
+		t.Errorf("Unexpected return code %d", rc)
+	}
+	if out != "ANR2034E SELECT: No match found using this criteria.\nANS8001I Return code 11.\n" {
+		t.Errorf("Unexpected out: %q", out)
+	}
+}
+
+func TestRunError(t *testing.T) {
+	logDir := setupSim(t)
+	rc, out, _ := runSim([]string{"-SERVERName=SIMERROR", "-DATAONLY=YES", "SELECT * FROM log"}, "")
+	if rc != 3 {
+		t.Errorf("Unexpected return code %d", rc)
+	}
+	if !strings.Contains(out, "ANR2904E") || !strings.Contains(out, "ANS8001I Return code 3.") {
+		t.Errorf("Unexpected out: %q", out)
+	}
+	errorLog, err := os.ReadFile(filepath.Join(logDir, "dsmerror.log"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !strings.Contains(string(errorLog), "ANR2904E") {
+		t.Errorf("Unexpected dsmerror.log: %q", string(errorLog))
+	}
+}
+
+func TestRunUnknownQuery(t *testing.T) {
+	setupSim(t)
+	rc, _, stderr := runSim([]string{"-DATAONLY=YES", "QUERY NODE"}, "")
+	if rc != 3 {
+		t.Errorf("Unexpected return code %d", rc)
+	}
+	if !strings.Contains(stderr, "no fixture matches command: QUERY NODE") {
+		t.Errorf("Unexpected stderr: %q", stderr)
+	}
+}
+
+func TestRunDelay(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(fixturesEnv, dir)
+	t.Setenv("DSM_LOG", dir)
+	if err := os.WriteFile(filepath.Join(dir, "slow.yaml"), []byte("query: QUERY STATUS\ndelay: 200ms\nstdout: foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	rc, out, _ := runSim([]string{"-DATAONLY=YES", "QUERY STATUS"}, "")
+	if rc != 0 || out != "foo" {
+		t.Errorf("Unexpected return code %d out %q", rc, out)
+	}
+	if time.Since(start) < 200*time.Millisecond {
+		t.Errorf("Expected query to be delayed")
+	}
+}
+
+func TestRunDSMLogNotWritable(t *testing.T) {
+	setupSim(t)
+	t.Setenv("DSM_LOG", filepath.Join(t.TempDir(), "missing"))
+	rc, out, _ := runSim([]string{"-DATAONLY=YES", "QUERY STATUS"}, "")
+	if rc != 12 {
+		t.Errorf("Unexpected return code %d", rc)
+	}
+	if !strings.Contains(out, "ANS1398E") {
+		t.Errorf("Unexpected out: %q", out)
+	}
+}
+
+func TestRunCredentials(t *testing.T) {
+	setupSim(t)
+	t.Setenv(idEnv, "admin")
+	t.Setenv(passwordEnv, "secret")
+	if rc, out, _ := runSim([]string{"-ID=admin", "-PAssword=wrong", "-DATAONLY=YES", "QUERY STATUS"}, ""); rc != 3 || !strings.Contains(out, "ANS8034E") {
+		t.Errorf("Unexpected return code %d out %q", rc, out)
+	}
+	rc, out, _ := runSim([]string{"-ID=admin", "-DATAONLY=YES", "QUERY STATUS"}, "secret\n")
+	if rc != 0 {
+		t.Errorf("Unexpected return code %d", rc)
+	}
+	if !strings.HasPrefix(out, "Enter your password:  ") {
+		t.Errorf("Unexpected out: %q", out)
+	}
+}
+
+func TestRunConsole(t *testing.T) {
+	setupSim(t)
+	rc, out, _ := runSim([]string{"-SERVERName=TSM1", "-DATAONLY=YES", "-COMMAdelimited"}, "SELECT FREE,TOTAL,USED FROM log\nSELECT 'END_1' FROM status\nquit\n")
+	if rc != 0 {
+		t.Errorf("Unexpected return code %d", rc)
+	}
+	expected := "Protect: TSM1> 32426.00,32768.00,342.00\nProtect: TSM1> END_1\nProtect: TSM1> "
+	if out != expected {
+		t.Errorf("Unexpected out: %q", out)
+	}
+}
+
+func TestMatchFixture(t *testing.T) {
+	fixtures, err := loadFixtures("fixtures")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	f := matchFixture(fixtures, "SELECT FREE,TOTAL,USED FROM log", "SIMERROR")
+	if f == nil || filepath.Base(f.file) != "sim-error.yaml" {
+		t.Errorf("Unexpected fixture %v", f)
+	}
+	f = matchFixture(fixtures, "SELECT FREE,TOTAL,USED FROM log", "TSM1")
+	if f == nil || filepath.Base(f.file) != "log.yaml" {
+		t.Errorf("Unexpected fixture %v", f)
+	}
+}
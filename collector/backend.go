@@ -0,0 +1,69 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+
+	"github.com/go-kit/log"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+// Backend runs a query against a TSM server and returns the output
+// in the comma delimited format produced by dsmadmc -DATAONLY=YES -COMMAdelimited
+type Backend interface {
+	Query(ctx context.Context, target *config.Target, query string, logger log.Logger) (string, error)
+}
+
+var (
+	backends = map[string]Backend{
+		config.BackendDsmadmc: &dsmadmcBackend{},
+		config.BackendRest:    newRestBackend(),
+		config.BackendSSH:     newSSHBackend(),
+	}
+)
+
+type dsmadmcBackend struct{}
+
+func (b *dsmadmcBackend) Query(ctx context.Context, target *config.Target, query string, logger log.Logger) (string, error) {
+	// Pooled sessions can not answer or detect credential prompts, so only argv logins are pooled
+	if *poolSize > 0 && target.Login != config.LoginPty && target.Login != config.LoginStored {
+		return getPool(target, logger).query(ctx, query, logger)
+	}
+	return dsmadmcExec(target, query, ctx, logger)
+}
+
+func getBackend(target *config.Target) Backend {
+	if backend, ok := backends[target.Backend]; ok {
+		return backend
+	}
+	return backends[config.BackendDsmadmc]
+}
+
+// dsmadmcQuery runs a query using the target's backend, or replays a recording of the query.
+// Queries run with the backend wait for a slot within the target's and the global query limits.
+func dsmadmcQuery(target *config.Target, query string, ctx context.Context, logger log.Logger) (string, error) {
+	if *replayDir != "" {
+		return replayQuery(target, query, ctx, logger)
+	}
+	release, err := acquireQuerySlot(ctx, target, logger)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	if *recordDir != "" {
+		return recordQuery(target, query, ctx, logger)
+	}
+	return getBackend(target).Query(ctx, target, query, logger)
+}
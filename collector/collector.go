@@ -21,6 +21,7 @@ import (
 	"math"
 	"os"
 	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -43,7 +44,7 @@ var (
 	execCommand     = exec.CommandContext
 	timeNow         = time.Now
 	collectorState  = make(map[string]bool)
-	factories       = make(map[string]func(target *config.Target, logger log.Logger) Collector)
+	factories       = make(map[string]func(ctx context.Context, target *config.Target, logger log.Logger) Collector)
 	collectDuration = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "exporter", "collector_duration_seconds"),
 		"Collector time duration.",
@@ -68,12 +69,15 @@ type TSMCollector struct {
 	Collectors map[string]Collector
 }
 
-func registerCollector(collector string, isDefaultEnabled bool, factory func(target *config.Target, logger log.Logger) Collector) {
+func registerCollector(collector string, isDefaultEnabled bool, factory func(ctx context.Context, target *config.Target, logger log.Logger) Collector) {
 	collectorState[collector] = isDefaultEnabled
 	factories[collector] = factory
+	config.RegisterCollector(collector)
 }
 
-func NewCollector(target *config.Target, logger log.Logger) *TSMCollector {
+// NewCollector returns the enabled collectors of a target, queries run by the collectors are canceled when ctx is done
+// and their deadlines are limited by the deadline of ctx.
+func NewCollector(ctx context.Context, target *config.Target, logger log.Logger) *TSMCollector {
 	collectors := make(map[string]Collector)
 	for key, enabled := range collectorState {
 		enable := false
@@ -84,13 +88,97 @@ func NewCollector(target *config.Target, logger log.Logger) *TSMCollector {
 		}
 		var collector Collector
 		if enable {
-			collector = factories[key](target, log.With(logger, "collector", key, "target", target.Name))
+			collector = factories[key](ctx, target, log.With(logger, "collector", key, "target", target.Name))
 			collectors[key] = collector
 		}
 	}
+	for _, query := range target.Queries {
+		collectors[query.Name] = NewQueryExporter(ctx, query, target, log.With(logger, "query", query.Name, "target", target.Name))
+	}
+	for key, collector := range collectors {
+		if _, ok := target.FallbackMaxStale[key]; ok {
+			collectors[key] = newFallbackCollector(key, collector, target)
+		}
+	}
 	return &TSMCollector{Collectors: collectors}
 }
 
+// ForgetTarget removes the state kept for a target name, such as its backend connections, session pool,
+// query limit, circuit breaker, last successful results and per target metrics
+func ForgetTarget(name string) {
+	for _, backend := range backends {
+		if b, ok := backend.(interface{ forget(name string) }); ok {
+			b.forget(name)
+		}
+	}
+	poolsLock.Lock()
+	if pool, ok := pools[name]; ok {
+		pool.close()
+		delete(pools, name)
+	}
+	poolsLock.Unlock()
+	poolSessions.DeleteLabelValues(name)
+	poolQueries.DeleteLabelValues(name)
+	poolRespawns.DeleteLabelValues(name)
+	forcedKills.DeleteLabelValues(name)
+	limitsLock.Lock()
+	delete(targetLimits, name)
+	limitsLock.Unlock()
+	queryQueueWait.DeletePartialMatch(prometheus.Labels{"target": name})
+	breakersLock.Lock()
+	delete(breakers, name)
+	breakersLock.Unlock()
+	lastGoodResultsLock.Lock()
+	for key := range lastGoodResults {
+		if strings.HasPrefix(key, scheduleKey(name, "")) {
+			delete(lastGoodResults, key)
+		}
+	}
+	lastGoodResultsLock.Unlock()
+}
+
+// CollectorNames returns the sorted names of the collectors and custom queries that can be used by a target
+func CollectorNames(target *config.Target) []string {
+	var names []string
+	for key := range collectorState {
+		names = append(names, key)
+	}
+	for _, query := range target.Queries {
+		names = append(names, query.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckCollectorNames returns an error listing the valid names if any of the names is not a collector or custom query of the target
+func CheckCollectorNames(target *config.Target, names []string) error {
+	valid := CollectorNames(target)
+	for _, name := range names {
+		if !sliceContains(valid, name) {
+			return fmt.Errorf("Unknown collector %s, valid collectors are: %s", name, strings.Join(valid, ", "))
+		}
+	}
+	return nil
+}
+
+// Filter limits the enabled collectors to those in collect, if any are given, and disables those in exclude
+func (c *TSMCollector) Filter(collect []string, exclude []string) {
+	for key := range c.Collectors {
+		if (len(collect) > 0 && !sliceContains(collect, key)) || sliceContains(exclude, key) {
+			delete(c.Collectors, key)
+		}
+	}
+}
+
+// collectorTimeout returns the timeout from the target's collector_options, defaulting to the collector's timeout flag
+func collectorTimeout(target *config.Target, collector string, flagTimeout int) time.Duration {
+	timeout := flagTimeout
+	if o := target.Options(collector); o.Timeout > 0 {
+		timeout = o.Timeout
+	}
+	return time.Duration(timeout) * time.Second
+}
+
 func sliceContains(slice []string, str string) bool {
 	for _, s := range slice {
 		if str == s {
@@ -141,18 +229,101 @@ func parseTime(v string, target *config.Target) (time.Time, error) {
 	return t, err
 }
 
-func dsmadmcQuery(target *config.Target, query string, ctx context.Context, logger log.Logger) (string, error) {
+func dsmadmcArgs(target *config.Target) []string {
 	servername := fmt.Sprintf("-SERVERName=%s", target.Servername)
 	id := fmt.Sprintf("-ID=%s", target.Id)
 	password := fmt.Sprintf("-PAssword=%s", target.Password)
+	args := []string{servername}
+	switch target.Login {
+	case config.LoginStored:
+	case config.LoginPty:
+		args = append(args, id)
+	default:
+		args = append(args, id, password)
+	}
+	return append(args, "-DATAONLY=YES", "-COMMAdelimited")
+}
+
+// dsmadmcCommand returns the dsmadmc command of a target with the target's client environment
+func dsmadmcCommand(ctx context.Context, target *config.Target, args ...string) *exec.Cmd {
+	cmd := execCommand(ctx, dsmadmcPath(target), args...)
+	setProcessGroup(cmd, target.Name)
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env, "DSM_LOG="+*dsmLogDir)
+	cmd.Env = append(cmd.Env, dsmadmcEnv(target)...)
+	return cmd
+}
+
+// dsmadmcPath returns the dsmadmc executable of a target, by default dsmadmc found in PATH
+func dsmadmcPath(target *config.Target) string {
+	if target.DsmadmcPath != "" {
+		return target.DsmadmcPath
+	}
+	return "dsmadmc"
+}
+
+// dsmadmcEnv returns the DSM_LOG, DSM_DIR and DSM_CONFIG environment variables defined by a target
+func dsmadmcEnv(target *config.Target) []string {
+	var env []string
+	if target.DsmLog != "" {
+		env = append(env, "DSM_LOG="+target.DsmLog)
+	}
+	if target.DsmDir != "" {
+		env = append(env, "DSM_DIR="+target.DsmDir)
+	}
+	if target.DsmConfig != "" {
+		env = append(env, "DSM_CONFIG="+target.DsmConfig)
+	}
+	return env
+}
+
+func dsmadmcExec(target *config.Target, query string, ctx context.Context, logger log.Logger) (string, error) {
+	args := append(dsmadmcArgs(target), query)
 	level.Debug(logger).Log("msg", "dsmadmc query", "query", query)
-	cmd := execCommand(ctx, "dsmadmc", servername, id, password, "-DATAONLY=YES", "-COMMAdelimited", query)
-	os.Setenv("DSM_LOG", *dsmLogDir)
+	cmdCtx, cancelCmd := context.WithCancel(ctx)
+	defer cancelCmd()
+	cmd := dsmadmcCommand(cmdCtx, target, args...)
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+	var err error
+	var exited bool
+	defer func() {
+		// Output is still being written by a process that has not exited
+		if !exited {
+			recordExec(ctx, "", "", err)
+			return
+		}
+		recordExec(ctx, stdout.String(), stderr.String(), err)
+	}()
+	var prompt *promptWriter
+	run := cmd.Run
+	switch target.Login {
+	case config.LoginPty:
+		run = func() error { return ptyRun(cmd, target.Password, &stdout) }
+	case config.LoginStored:
+		prompt = &promptWriter{w: &stdout, cancel: cancelCmd}
+		cmd.Stdout = prompt
+		cmd.Stderr = &stderr
+	default:
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+	}
+	exited, err = runProcess(cmdCtx, run)
+	if prompt != nil {
+		if match, out := prompt.found(); match != "" {
+			level.Error(logger).Log("msg", "dsmadmc prompted for credentials", "prompt", match, "out", out)
+			return "", fmt.Errorf("dsmadmc prompted for credentials (%s), stored password is missing or expired", match)
+		}
+	}
+	if !exited {
+		if ctx.Err() == context.DeadlineExceeded {
+			level.Error(logger).Log("msg", "Timeout executing dsmadmc")
+		}
+		return "", err
+	}
 	if err != nil {
 		if strings.Contains(stdout.String(), "No match found using this criteria") {
 			return "", nil
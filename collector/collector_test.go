@@ -14,12 +14,15 @@
 package collector
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"math"
 	"os"
 	"os/exec"
+	"regexp"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -32,17 +35,21 @@ import (
 var (
 	mockedExitStatus = 0
 	mockedStdout     string
+	mockedPassword   string
+	mockedArgs       []string
 	_, cancel        = context.WithTimeout(context.Background(), 5*time.Second)
 )
 
 func fakeExecCommand(ctx context.Context, command string, args ...string) *exec.Cmd {
 	cs := []string{"-test.run=TestExecCommandHelper", "--", command}
 	cs = append(cs, args...)
+	mockedArgs = args
 	defer cancel()
 	cmd := exec.CommandContext(ctx, os.Args[0], cs...)
 	es := strconv.Itoa(mockedExitStatus)
 	cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1",
 		"STDOUT=" + mockedStdout,
+		"PASSWORD=" + mockedPassword,
 		"EXIT_STATUS=" + es}
 	return cmd
 }
@@ -52,12 +59,62 @@ func TestExecCommandHelper(t *testing.T) {
 		return
 	}
 
+	if os.Args[len(os.Args)-1] == "-COMMAdelimited" {
+		consoleHelper()
+	}
+	if password := os.Getenv("PASSWORD"); password != "" {
+		for _, arg := range os.Args {
+			if strings.Contains(arg, password) {
+				fmt.Fprintf(os.Stdout, "password found in arguments\n")
+				os.Exit(2)
+			}
+		}
+		fmt.Fprintf(os.Stdout, "Enter your password:  ")
+		input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(input) != password {
+			fmt.Fprintf(os.Stdout, "ANS8034E Your administrator ID is not recognized by this server.\n")
+			os.Exit(3)
+		}
+	}
 	//nolint:staticcheck
 	fmt.Fprintf(os.Stdout, os.Getenv("STDOUT"))
 	i, _ := strconv.Atoi(os.Getenv("EXIT_STATUS"))
 	os.Exit(i)
 }
 
+// consoleHelper acts as an interactive dsmadmc console session
+func consoleHelper() {
+	marker := regexp.MustCompile(`^SELECT '(\S+)' FROM status$`)
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprintf(os.Stdout, "Protect: TSM1> ")
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			os.Exit(0)
+		}
+		line = strings.TrimSpace(line)
+		if m := marker.FindStringSubmatch(line); m != nil {
+			fmt.Fprintf(os.Stdout, "%s\n", m[1])
+			continue
+		}
+		switch line {
+		case "quit":
+			os.Exit(0)
+		case "crash":
+			os.Exit(1)
+		case "hang":
+			time.Sleep(10 * time.Second)
+		case "error":
+			fmt.Fprintf(os.Stdout, "ANR2000E Unknown command - ERROR.\n")
+		case "nomatch":
+			fmt.Fprintf(os.Stdout, "ANR2034E SELECT: No match found using this criteria.\n")
+		default:
+			//nolint:staticcheck
+			fmt.Fprintf(os.Stdout, os.Getenv("STDOUT"))
+		}
+	}
+}
+
 func setupGatherer(collector Collector) prometheus.Gatherer {
 	registry := prometheus.NewRegistry()
 	registry.MustRegister(collector)
@@ -93,6 +150,36 @@ func TestDsmadmcQueryWithNoResultsError(t *testing.T) {
 	}
 }
 
+func TestDsmadmcCommand(t *testing.T) {
+	execCommand = fakeExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	if _, err := kingpin.CommandLine.Parse([]string{"--path.dsm_log.dir=/var/log/tsm"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = kingpin.CommandLine.Parse([]string{}) }()
+	cmd := dsmadmcCommand(context.Background(), &config.Target{}, "query")
+	if cmd.Args[3] != "dsmadmc" {
+		t.Errorf("Unexpected command: %v", cmd.Args)
+	}
+	if env := cmd.Env[len(cmd.Env)-1]; env != "DSM_LOG=/var/log/tsm" {
+		t.Errorf("Unexpected environment: %s", env)
+	}
+	target := &config.Target{
+		DsmDir:      "/opt/tsm1",
+		DsmConfig:   "/opt/tsm1/dsm.opt",
+		DsmLog:      "/var/log/tsm1",
+		DsmadmcPath: "/opt/tsm1/bin/dsmadmc",
+	}
+	cmd = dsmadmcCommand(context.Background(), target, "query")
+	if cmd.Args[3] != "/opt/tsm1/bin/dsmadmc" {
+		t.Errorf("Unexpected command: %v", cmd.Args)
+	}
+	expected := []string{"DSM_LOG=/var/log/tsm", "DSM_LOG=/var/log/tsm1", "DSM_DIR=/opt/tsm1", "DSM_CONFIG=/opt/tsm1/dsm.opt"}
+	if env := cmd.Env[len(cmd.Env)-4:]; strings.Join(env, " ") != strings.Join(expected, " ") {
+		t.Errorf("Unexpected environment\nExpected: %v\nGot: %v", expected, env)
+	}
+}
+
 func TestParseFloat(t *testing.T) {
 	tests := []struct {
 		Input         string
@@ -179,3 +266,75 @@ func TestParseTimeError(t *testing.T) {
 		t.Errorf("Expected error for case 2")
 	}
 }
+
+func TestCheckCollectorNames(t *testing.T) {
+	target := &config.Target{Name: "tsm1", Queries: []*config.Query{{Name: "nodes"}}}
+	if err := CheckCollectorNames(target, []string{"status", "nodes"}); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	err := CheckCollectorNames(target, []string{"status", "dne"})
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	if !strings.HasPrefix(err.Error(), "Unknown collector dne, valid collectors are: db, drives, events, libvolumes, log, nodes, occupancy") {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	target := &config.Target{Name: "tsm1", Collectors: []string{"status", "db", "log"}}
+	tsmCollector := NewCollector(context.Background(), target, log.NewNopLogger())
+	tsmCollector.Filter([]string{"status", "db", "volumes"}, []string{"db"})
+	if len(tsmCollector.Collectors) != 1 {
+		t.Errorf("Unexpected collectors %v", tsmCollector.Collectors)
+	}
+	if _, ok := tsmCollector.Collectors["status"]; !ok {
+		t.Errorf("Expected status collector")
+	}
+	tsmCollector = NewCollector(context.Background(), target, log.NewNopLogger())
+	tsmCollector.Filter(nil, []string{"db"})
+	if len(tsmCollector.Collectors) != 2 {
+		t.Errorf("Unexpected collectors %v", tsmCollector.Collectors)
+	}
+}
+
+func TestCollectorTimeout(t *testing.T) {
+	target := &config.Target{
+		CollectorOptions: map[string]*config.CollectorOptions{"db": {Timeout: 30}},
+	}
+	if timeout := collectorTimeout(target, "db", 10); timeout != 30*time.Second {
+		t.Errorf("Unexpected timeout %s", timeout)
+	}
+	if timeout := collectorTimeout(target, "log", 10); timeout != 10*time.Second {
+		t.Errorf("Unexpected timeout %s", timeout)
+	}
+}
+
+func TestForgetTarget(t *testing.T) {
+	name := "forget.example.com"
+	getCircuitBreaker(name)
+	getLastGood(name, "log")
+	getLastGood(name+"2", "log")
+	getTargetLimit(&config.Target{Name: name, MaxSessions: 1})
+	poolQueries.WithLabelValues(name).Inc()
+	queryQueueWait.WithLabelValues(name, queueTarget).Observe(1)
+	ForgetTarget(name)
+	if _, ok := breakers[name]; ok {
+		t.Errorf("Circuit breaker was not removed")
+	}
+	if _, ok := targetLimits[name]; ok {
+		t.Errorf("Query limit was not removed")
+	}
+	if _, ok := lastGoodResults[scheduleKey(name, "log")]; ok {
+		t.Errorf("Last successful results were not removed")
+	}
+	if _, ok := lastGoodResults[scheduleKey(name+"2", "log")]; !ok {
+		t.Errorf("Last successful results of another target were removed")
+	}
+	if poolQueries.DeleteLabelValues(name) {
+		t.Errorf("Pool metrics were not removed")
+	}
+	if queryQueueWait.DeleteLabelValues(name, queueTarget) {
+		t.Errorf("Queue wait metrics were not removed")
+	}
+}
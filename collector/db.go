@@ -77,6 +77,7 @@ type DBCollector struct {
 	SortOverflow *prometheus.Desc
 	PkgHitRatio  *prometheus.Desc
 	LastBackup   *prometheus.Desc
+	ctx          context.Context
 	target       *config.Target
 	logger       log.Logger
 }
@@ -85,7 +86,7 @@ func init() {
 	registerCollector("db", true, NewDBExporter)
 }
 
-func NewDBExporter(target *config.Target, logger log.Logger) Collector {
+func NewDBExporter(ctx context.Context, target *config.Target, logger log.Logger) Collector {
 	return &DBCollector{
 		TotalSpace: prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "space_total_bytes"),
 			"DB total space in bytes", []string{"dbname"}, nil),
@@ -111,6 +112,7 @@ func NewDBExporter(target *config.Target, logger log.Logger) Collector {
 			"DB pkg hit ratio (0.0-1.0)", []string{"dbname"}, nil),
 		LastBackup: prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "last_backup_timestamp_seconds"),
 			"Time since last backup in epoch", []string{"dbname"}, nil),
+		ctx:    ctx,
 		target: target,
 		logger: logger,
 	}
@@ -165,7 +167,7 @@ func (c *DBCollector) Collect(ch chan<- prometheus.Metric) {
 }
 
 func (c *DBCollector) collect() ([]DBMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*dbTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(c.ctx, collectorTimeout(c.target, "db", *dbTimeout))
 	defer cancel()
 	out, err := DsmadmcDBExec(c.target, ctx, c.logger)
 	if err != nil {
@@ -159,7 +159,7 @@ func TestDBCollector(t *testing.T) {
 	timezone = &zone
 	w := log.NewSyncWriter(os.Stderr)
 	logger := log.NewLogfmtLogger(w)
-	collector := NewDBExporter(&config.Target{}, logger)
+	collector := NewDBExporter(context.Background(), &config.Target{}, logger)
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -191,7 +191,7 @@ func TestDBCollectorError(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="db"} 0
 	`
-	collector := NewDBExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewDBExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -219,7 +219,7 @@ func TestDBCollectorTimeout(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="db"} 1
 	`
-	collector := NewDBExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewDBExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
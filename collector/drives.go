@@ -44,6 +44,7 @@ type DrivesCollector struct {
 	online *prometheus.Desc
 	state  *prometheus.Desc
 	volume *prometheus.Desc
+	ctx    context.Context
 	target *config.Target
 	logger log.Logger
 }
@@ -52,7 +53,7 @@ func init() {
 	registerCollector("drives", true, NewDrivesExporter)
 }
 
-func NewDrivesExporter(target *config.Target, logger log.Logger) Collector {
+func NewDrivesExporter(ctx context.Context, target *config.Target, logger log.Logger) Collector {
 	return &DrivesCollector{
 		online: prometheus.NewDesc(prometheus.BuildFQName(namespace, "drive", "online"),
 			"Inidicates if the drive is online, 1=online, 0=offline", []string{"library", "drive"}, nil),
@@ -60,6 +61,7 @@ func NewDrivesExporter(target *config.Target, logger log.Logger) Collector {
 			"Current state of the drive", []string{"library", "drive", "state"}, nil),
 		volume: prometheus.NewDesc(prometheus.BuildFQName(namespace, "drive", "volume_info"),
 			"Current volume of the drive", []string{"library", "drive", "volume"}, nil),
+		ctx:    ctx,
 		target: target,
 		logger: logger,
 	}
@@ -107,7 +109,7 @@ func (c *DrivesCollector) Collect(ch chan<- prometheus.Metric) {
 }
 
 func (c *DrivesCollector) collect() ([]DriveMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*drivesTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(c.ctx, collectorTimeout(c.target, "drives", *drivesTimeout))
 	defer cancel()
 	out, err := DsmadmcDrivesExec(c.target, ctx, c.logger)
 	if err != nil {
@@ -119,8 +121,8 @@ func (c *DrivesCollector) collect() ([]DriveMetric, error) {
 
 func buildDrivesQuery(target *config.Target) string {
 	query := "SELECT library_name,drive_name,online,drive_state,volume_name FROM drives"
-	if target.LibraryName != "" {
-		query = query + fmt.Sprintf(" WHERE library_name='%s'", target.LibraryName)
+	if libraryName := target.Options("drives").LibraryName; libraryName != "" {
+		query = query + fmt.Sprintf(" WHERE library_name='%s'", libraryName)
 	}
 	return query
 }
@@ -138,7 +138,7 @@ func TestDrivesCollector(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="drives"} 0
 	`
-	collector := NewDrivesExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewDrivesExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -167,7 +167,7 @@ func TestDrivesCollectorError(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="drives"} 0
 	`
-	collector := NewDrivesExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewDrivesExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -196,7 +196,7 @@ func TestDrivesCollectorTimeout(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="drives"} 1
 	`
-	collector := NewDrivesExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewDrivesExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -27,6 +27,11 @@ import (
 	"github.com/treydock/tsm_exporter/config"
 )
 
+const (
+	// eventsWindow is how far back schedules that have not completed are queried
+	eventsWindow = 24 * time.Hour
+)
+
 var (
 	eventsTimeout                 = kingpin.Flag("collector.events.timeout", "Timeout for collecting events information").Default("10").Int()
 	DsmadmcEventsCompletedExec    = dsmadmcEventsCompleted
@@ -46,6 +51,7 @@ type EventsCollector struct {
 	start        *prometheus.Desc
 	completed    *prometheus.Desc
 	duration     *prometheus.Desc
+	ctx          context.Context
 	target       *config.Target
 	logger       log.Logger
 }
@@ -54,7 +60,7 @@ func init() {
 	registerCollector("events", true, NewEventsExporter)
 }
 
-func NewEventsExporter(target *config.Target, logger log.Logger) Collector {
+func NewEventsExporter(ctx context.Context, target *config.Target, logger log.Logger) Collector {
 	return &EventsCollector{
 		notCompleted: prometheus.NewDesc(prometheus.BuildFQName(namespace, "schedule", "not_completed"),
 			"Number of scheduled events not completed for today", []string{"schedule"}, nil),
@@ -64,6 +70,7 @@ func NewEventsExporter(target *config.Target, logger log.Logger) Collector {
 			"Completed time of the most recent completed scheduled event", []string{"schedule"}, nil),
 		duration: prometheus.NewDesc(prometheus.BuildFQName(namespace, "schedule", "duration_seconds"),
 			"Amount of time taken to complete the most recent completed scheduled event", []string{"schedule"}, nil),
+		ctx:    ctx,
 		target: target,
 		logger: logger,
 	}
@@ -104,7 +111,7 @@ func (c *EventsCollector) Collect(ch chan<- prometheus.Metric) {
 }
 
 func (c *EventsCollector) collect() (map[string]EventMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*eventsTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(c.ctx, collectorTimeout(c.target, "events", *eventsTimeout))
 	defer cancel()
 	var completedOut, notCompletedOut string
 	var completedErr, notCompletedErr error
@@ -131,8 +138,8 @@ func (c *EventsCollector) collect() (map[string]EventMetric, error) {
 
 func buildEventsCompletedQuery(target *config.Target) string {
 	query := "SELECT schedule_name, actual_start, completed FROM events WHERE"
-	if target.Schedules != nil {
-		query = query + fmt.Sprintf(" schedule_name IN (%s) AND", buildInFilter(target.Schedules))
+	if schedules := target.Options("events").Schedules; schedules != nil {
+		query = query + fmt.Sprintf(" schedule_name IN (%s) AND", buildInFilter(schedules))
 	}
 	query = query + " status = 'Completed' ORDER BY completed DESC"
 	return query
@@ -145,13 +152,18 @@ func dsmadmcEventsCompleted(target *config.Target, ctx context.Context, logger l
 
 func buildEventsNotCompletedQuery(target *config.Target) string {
 	query := "SELECT schedule_name,status FROM events WHERE"
+	options := target.Options("events")
+	window := options.Window
+	if window == 0 {
+		window = eventsWindow
+	}
 	now := timeNow().Local()
 	today := now.Format("2006-01-02")
-	yesterday := now.AddDate(0, 0, -1).Format("2006-01-02")
-	if target.Schedules != nil {
-		query = query + fmt.Sprintf(" schedule_name IN (%s) AND", buildInFilter(target.Schedules))
+	start := now.Add(-window).Format("2006-01-02")
+	if options.Schedules != nil {
+		query = query + fmt.Sprintf(" schedule_name IN (%s) AND", buildInFilter(options.Schedules))
 	}
-	query = query + fmt.Sprintf(" DATE(scheduled_start) BETWEEN '%s' AND '%s'", yesterday, today)
+	query = query + fmt.Sprintf(" DATE(scheduled_start) BETWEEN '%s' AND '%s'", start, today)
 	return query
 }
 
@@ -73,6 +73,25 @@ func TestBuildEventsNotCompletedQuery(t *testing.T) {
 	}
 }
 
+func TestBuildEventsNotCompletedQueryOptions(t *testing.T) {
+	mockNow, _ := time.Parse("01/02/2006 15:04:05", "07/02/2020 13:00:00")
+	timeNow = func() time.Time {
+		return mockNow
+	}
+	target := &config.Target{
+		Name:      "test",
+		Schedules: []string{"FOO"},
+		CollectorOptions: map[string]*config.CollectorOptions{
+			"events": {Schedules: []string{"BAR"}, Window: 72 * time.Hour},
+		},
+	}
+	expectedQuery := "SELECT schedule_name,status FROM events WHERE schedule_name IN ('BAR') AND DATE(scheduled_start) BETWEEN '2020-06-29' AND '2020-07-02'"
+	query := buildEventsNotCompletedQuery(target)
+	if query != expectedQuery {
+		t.Errorf("Expected: %s\nGot: %s", expectedQuery, query)
+	}
+}
+
 func TestEventsParse(t *testing.T) {
 	metrics, err := eventsParse(mockEventCompletedStdout, mockEventNotCompletedStdout, &config.Target{}, log.NewNopLogger())
 	if err != nil {
@@ -150,7 +169,7 @@ func TestEventsCollector(t *testing.T) {
 	`
 	w := log.NewSyncWriter(os.Stderr)
 	logger := log.NewLogfmtLogger(w)
-	collector := NewEventsExporter(&config.Target{}, logger)
+	collector := NewEventsExporter(context.Background(), &config.Target{}, logger)
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -183,7 +202,7 @@ func TestEventsCollectorError(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="events"} 0
 	`
-	collector := NewEventsExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewEventsExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -231,7 +250,7 @@ func TestEventsCollectorTimeout(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="events"} 1
 	`
-	collector := NewEventsExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewEventsExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
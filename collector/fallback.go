@@ -0,0 +1,121 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+var (
+	collectorStale = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "collector_stale"),
+		"Indicates the collector failed and the last successful results are served",
+		[]string{"collector"}, nil)
+	lastGoodResults     = make(map[string]*lastGood)
+	lastGoodResultsLock = sync.Mutex{}
+)
+
+// lastGood holds the results of the last successful collection, kept across scrapes and config reloads
+type lastGood struct {
+	sync.Mutex
+	metrics []prometheus.Metric
+	updated time.Time
+}
+
+func getLastGood(target string, collector string) *lastGood {
+	lastGoodResultsLock.Lock()
+	defer lastGoodResultsLock.Unlock()
+	key := scheduleKey(target, collector)
+	good, ok := lastGoodResults[key]
+	if !ok {
+		good = &lastGood{}
+		lastGoodResults[key] = good
+	}
+	return good
+}
+
+// fallbackCollector serves the last successful results of a collector when collection fails
+type fallbackCollector struct {
+	name      string
+	collector Collector
+	maxStale  time.Duration
+	good      *lastGood
+}
+
+func newFallbackCollector(name string, collector Collector, target *config.Target) Collector {
+	return &fallbackCollector{
+		name:      name,
+		collector: collector,
+		maxStale:  target.FallbackMaxStale[name],
+		good:      getLastGood(target.Name, name),
+	}
+}
+
+func (c *fallbackCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.collector.Describe(ch)
+}
+
+func (c *fallbackCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics := gatherCollector(c.collector)
+	now := time.Now()
+	c.good.Lock()
+	defer c.good.Unlock()
+	success := collectSucceeded(metrics)
+	if success {
+		c.good.metrics = dataMetrics(metrics)
+		c.good.updated = now
+	}
+	if emitWithFallback(ch, c.name, metrics, c.good.metrics, c.good.updated, now, c.maxStale) || success {
+		ch <- prometheus.MustNewConstMetric(collectorCacheAge, prometheus.GaugeValue, now.Sub(c.good.updated).Seconds(), c.name)
+	}
+}
+
+// emitWithFallback sends the collected metrics, or if collection failed and the last successful results
+// are not older than maxStale, the last successful data metrics with the collected status metrics.
+// Returns true if the last successful results were sent.
+func emitWithFallback(ch chan<- prometheus.Metric, name string, metrics []prometheus.Metric, good []prometheus.Metric, updated time.Time, now time.Time, maxStale time.Duration) bool {
+	stale := !collectSucceeded(metrics) && !updated.IsZero() && now.Sub(updated) <= maxStale
+	for _, metric := range metrics {
+		if !stale || isStatusMetric(metric) {
+			ch <- metric
+		}
+	}
+	if stale {
+		for _, metric := range good {
+			ch <- metric
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(collectorStale, prometheus.GaugeValue, boolToFloat64(stale), name)
+	return stale
+}
+
+func isStatusMetric(metric prometheus.Metric) bool {
+	desc := metric.Desc()
+	return desc == collectError || desc == collecTimeout || desc == collectDuration
+}
+
+// dataMetrics returns the metrics other than collect_error, collect_timeout and collector_duration_seconds
+func dataMetrics(metrics []prometheus.Metric) []prometheus.Metric {
+	var data []prometheus.Metric
+	for _, metric := range metrics {
+		if !isStatusMetric(metric) {
+			data = append(data, metric)
+		}
+	}
+	return data
+}
@@ -0,0 +1,188 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+func mockFallbackLog(t *testing.T) *atomic.Bool {
+	var fail atomic.Bool
+	DsmadmcLogExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		if fail.Load() {
+			return "", fmt.Errorf("error")
+		}
+		return mockedLogStdout, nil
+	}
+	t.Cleanup(func() { DsmadmcLogExec = dsmadmcLog })
+	return &fail
+}
+
+func fallbackTarget(name string, maxStale time.Duration) *config.Target {
+	return &config.Target{
+		Name:             name,
+		Collectors:       []string{"log"},
+		FallbackMaxStale: map[string]time.Duration{"log": maxStale},
+	}
+}
+
+func TestFallbackCollector(t *testing.T) {
+	fail := mockFallbackLog(t)
+	target := fallbackTarget("fallback1", time.Hour)
+	collector := NewCollector(context.Background(), target, log.NewNopLogger()).Collectors["log"]
+	if _, ok := collector.(*fallbackCollector); !ok {
+		t.Fatalf("log collector does not use fallback")
+	}
+	gatherers := setupGatherer(collector)
+	if _, err := gatherers.Gather(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	fail.Store(true)
+	expected := `
+	# HELP tsm_active_log_total_bytes Active log total space in bytes
+	# TYPE tsm_active_log_total_bytes gauge
+	tsm_active_log_total_bytes 34359738368
+	# HELP tsm_exporter_collect_error Indicates if error has occurred during collection
+	# TYPE tsm_exporter_collect_error gauge
+	tsm_exporter_collect_error{collector="log"} 1
+	# HELP tsm_exporter_collector_stale Indicates the collector failed and the last successful results are served
+	# TYPE tsm_exporter_collector_stale gauge
+	tsm_exporter_collector_stale{collector="log"} 1
+	`
+	if err := testutil.GatherAndCompare(setupGatherer(NewCollector(context.Background(), target, log.NewNopLogger()).Collectors["log"]), strings.NewReader(expected),
+		"tsm_active_log_total_bytes", "tsm_exporter_collect_error", "tsm_exporter_collector_stale"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	if val, err := testutil.GatherAndCount(gatherers, "tsm_exporter_collector_cache_age_seconds"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 1 {
+		t.Errorf("Unexpected collection count %d, expected 1", val)
+	}
+}
+
+func TestFallbackCollectorExpired(t *testing.T) {
+	fail := mockFallbackLog(t)
+	target := fallbackTarget("fallback2", time.Millisecond)
+	gatherers := setupGatherer(NewCollector(context.Background(), target, log.NewNopLogger()).Collectors["log"])
+	if _, err := gatherers.Gather(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	fail.Store(true)
+	time.Sleep(10 * time.Millisecond)
+	expected := `
+	# HELP tsm_exporter_collector_stale Indicates the collector failed and the last successful results are served
+	# TYPE tsm_exporter_collector_stale gauge
+	tsm_exporter_collector_stale{collector="log"} 0
+	`
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "tsm_exporter_collector_stale"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	if val, err := testutil.GatherAndCount(gatherers, "tsm_active_log_total_bytes", "tsm_exporter_collector_cache_age_seconds"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 0 {
+		t.Errorf("Unexpected collection count %d, expected 0", val)
+	}
+}
+
+func TestFallbackCollectorNoSuccess(t *testing.T) {
+	fail := mockFallbackLog(t)
+	fail.Store(true)
+	target := fallbackTarget("fallback3", time.Hour)
+	gatherers := setupGatherer(NewCollector(context.Background(), target, log.NewNopLogger()).Collectors["log"])
+	if val, err := testutil.GatherAndCount(gatherers, "tsm_active_log_total_bytes", "tsm_exporter_collector_cache_age_seconds"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 0 {
+		t.Errorf("Unexpected collection count %d, expected 0", val)
+	}
+}
+
+func TestFallbackCollectorConcurrent(t *testing.T) {
+	fail := mockFallbackLog(t)
+	target := fallbackTarget("fallback4", time.Hour)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i == 5 {
+				fail.Store(true)
+			}
+			gatherers := setupGatherer(NewCollector(context.Background(), target, log.NewNopLogger()).Collectors["log"])
+			if _, err := gatherers.Gather(); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSchedulerFallback(t *testing.T) {
+	fail := mockFallbackLog(t)
+	path := filepath.Join(t.TempDir(), "tsm_exporter.yaml")
+	data := `
+refresh:
+  log: 20ms
+fallback:
+  log: 1h
+targets:
+  tsm1.example.com:
+    id: somwell
+    password: secret
+    collectors:
+      - log
+`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sc := &config.SafeConfig{}
+	if err := sc.ReloadConfig(path); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	target := sc.C.Targets["tsm1.example.com"]
+	s := NewScheduler(log.NewNopLogger())
+	defer s.Stop()
+	s.Update(sc.C.Targets)
+	waitForRefresh(t, s, "tsm1.example.com/log")
+	fail.Store(true)
+	time.Sleep(100 * time.Millisecond)
+	tsmCollector := NewCollector(context.Background(), target, log.NewNopLogger())
+	s.Cached(target, tsmCollector)
+	expected := `
+	# HELP tsm_active_log_total_bytes Active log total space in bytes
+	# TYPE tsm_active_log_total_bytes gauge
+	tsm_active_log_total_bytes 34359738368
+	# HELP tsm_exporter_collect_error Indicates if error has occurred during collection
+	# TYPE tsm_exporter_collect_error gauge
+	tsm_exporter_collect_error{collector="log"} 1
+	# HELP tsm_exporter_collector_stale Indicates the collector failed and the last successful results are served
+	# TYPE tsm_exporter_collector_stale gauge
+	tsm_exporter_collector_stale{collector="log"} 1
+	`
+	if err := testutil.GatherAndCompare(setupGatherer(tsmCollector.Collectors["log"]), strings.NewReader(expected),
+		"tsm_active_log_total_bytes", "tsm_exporter_collect_error", "tsm_exporter_collector_stale"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
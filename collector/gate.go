@@ -0,0 +1,181 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+const (
+	probeQuery = "SELECT 'TSM_EXPORTER_PROBE' FROM status"
+	// Reasons the collectors of a target are skipped
+	ReasonTimeout     = "timeout"
+	ReasonError       = "error"
+	ReasonCircuitOpen = "circuit_open"
+)
+
+var (
+	probeEnabled     = kingpin.Flag("collector.probe", "Check the TSM server is reachable before running collectors, use --no-collector.probe to disable").Default("true").Bool()
+	probeTimeout     = kingpin.Flag("collector.probe.timeout", "Timeout for checking the TSM server is reachable").Default("5").Int()
+	probeBackoff     = kingpin.Flag("collector.probe.backoff", "Time to skip a TSM server after the first failed reachability check, doubled for each consecutive failure").Default("30s").Duration()
+	probeMaxBackoff  = kingpin.Flag("collector.probe.max-backoff", "Maximum time to skip a TSM server that keeps failing reachability checks").Default("10m").Duration()
+	DsmadmcProbeExec = dsmadmcProbe
+	breakers         = make(map[string]*circuitBreaker)
+	breakersLock     = sync.Mutex{}
+)
+
+// circuitBreaker skips the reachability check of a failing target until its backoff expires
+type circuitBreaker struct {
+	sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func getCircuitBreaker(target string) *circuitBreaker {
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+	breaker, ok := breakers[target]
+	if !ok {
+		breaker = &circuitBreaker{}
+		breakers[target] = breaker
+	}
+	return breaker
+}
+
+func (b *circuitBreaker) open(now time.Time) bool {
+	b.Lock()
+	defer b.Unlock()
+	return now.Before(b.openUntil)
+}
+
+func (b *circuitBreaker) success() {
+	b.Lock()
+	defer b.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+// failure opens the circuit for the backoff doubled for each consecutive failure, up to the maximum backoff
+func (b *circuitBreaker) failure(now time.Time) time.Duration {
+	b.Lock()
+	defer b.Unlock()
+	b.failures++
+	backoff := *probeBackoff
+	for i := 1; i < b.failures && backoff < *probeMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > *probeMaxBackoff {
+		backoff = *probeMaxBackoff
+	}
+	b.openUntil = now.Add(backoff)
+	return backoff
+}
+
+// CheckConnectivity checks the TSM server of a target is reachable before collectors run.
+// Returns an empty string if the collectors should run, otherwise the reason they should be skipped.
+// Targets that keep failing are not checked again until their backoff expires.
+func CheckConnectivity(ctx context.Context, target *config.Target, logger log.Logger) string {
+	if !*probeEnabled {
+		return ""
+	}
+	logger = log.With(logger, "target", target.Name)
+	breaker := getCircuitBreaker(target.Name)
+	if breaker.open(timeNow()) {
+		level.Debug(logger).Log("msg", "Skipping collectors, circuit breaker is open")
+		return ReasonCircuitOpen
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, time.Duration(*probeTimeout)*time.Second)
+	defer cancel()
+	_, err := DsmadmcProbeExec(target, probeCtx, logger)
+	if err == nil {
+		breaker.success()
+		return ""
+	}
+	if ctx.Err() == context.Canceled {
+		// The scrape was abandoned, this says nothing about the server
+		return ReasonError
+	}
+	reason := ReasonError
+	if err == context.DeadlineExceeded {
+		reason = ReasonTimeout
+	}
+	backoff := breaker.failure(timeNow())
+	level.Error(logger).Log("msg", "TSM server is unreachable, skipping collectors", "reason", reason, "backoff", backoff, "err", err)
+	return reason
+}
+
+// Gate checks the TSM server of a target is reachable when any of the collectors queries it.
+// If it is not, the collectors that query the server are removed and those with a fallback serve their last successful results,
+// collectors served from the background collection cache are kept. Returns the reason the server is unreachable, if any.
+func (c *TSMCollector) Gate(ctx context.Context, target *config.Target, logger log.Logger) string {
+	live := false
+	for _, collector := range c.Collectors {
+		if _, ok := collector.(*cachedCollector); !ok {
+			live = true
+			break
+		}
+	}
+	if !live {
+		return ""
+	}
+	reason := CheckConnectivity(ctx, target, logger)
+	if reason == "" {
+		return ""
+	}
+	for key, collector := range c.Collectors {
+		switch collector := collector.(type) {
+		case *cachedCollector:
+		case *fallbackCollector:
+			c.Collectors[key] = &fallbackCollector{
+				name:      collector.name,
+				collector: &skippedCollector{name: key},
+				maxStale:  collector.maxStale,
+				good:      collector.good,
+			}
+		default:
+			delete(c.Collectors, key)
+		}
+	}
+	return reason
+}
+
+// skippedCollector reports an error for a collector that was not run because the TSM server is unreachable
+type skippedCollector struct {
+	name string
+}
+
+func (c *skippedCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+func (c *skippedCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, 1, c.name)
+	ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, 0, c.name)
+}
+
+func dsmadmcProbe(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+	out, err := dsmadmcQuery(target, probeQuery, ctx, logger)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+func mockProbe(t *testing.T, err error) *int {
+	var calls int
+	DsmadmcProbeExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		calls++
+		return "TSM_EXPORTER_PROBE", err
+	}
+	t.Cleanup(func() { DsmadmcProbeExec = dsmadmcProbe })
+	return &calls
+}
+
+func TestCheckConnectivity(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	calls := mockProbe(t, nil)
+	target := &config.Target{Name: "probe1.example.com"}
+	if reason := CheckConnectivity(context.Background(), target, log.NewNopLogger()); reason != "" {
+		t.Errorf("Unexpected reason %s", reason)
+	}
+	if *calls != 1 {
+		t.Errorf("Unexpected probe calls %d", *calls)
+	}
+}
+
+func TestCheckConnectivityFailure(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	calls := mockProbe(t, fmt.Errorf("ANS1017E Session rejected: TCP/IP connection failure."))
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+	target := &config.Target{Name: "probe2.example.com"}
+	if reason := CheckConnectivity(context.Background(), target, log.NewNopLogger()); reason != ReasonError {
+		t.Errorf("Unexpected reason %s", reason)
+	}
+	if reason := CheckConnectivity(context.Background(), target, log.NewNopLogger()); reason != ReasonCircuitOpen {
+		t.Errorf("Unexpected reason %s", reason)
+	}
+	if *calls != 1 {
+		t.Errorf("Unexpected probe calls %d while circuit is open", *calls)
+	}
+	// The probe is retried once the backoff expires and a success closes the circuit
+	now = now.Add(31 * time.Second)
+	_ = mockProbe(t, nil)
+	if reason := CheckConnectivity(context.Background(), target, log.NewNopLogger()); reason != "" {
+		t.Errorf("Unexpected reason %s", reason)
+	}
+	if b := getCircuitBreaker(target.Name); b.failures != 0 || !b.openUntil.IsZero() {
+		t.Errorf("Circuit breaker was not reset")
+	}
+}
+
+func TestCheckConnectivityTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	_ = mockProbe(t, context.DeadlineExceeded)
+	target := &config.Target{Name: "probe3.example.com"}
+	if reason := CheckConnectivity(context.Background(), target, log.NewNopLogger()); reason != ReasonTimeout {
+		t.Errorf("Unexpected reason %s", reason)
+	}
+}
+
+func TestCheckConnectivityDisabled(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--no-collector.probe"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = kingpin.CommandLine.Parse([]string{}) }()
+	calls := mockProbe(t, fmt.Errorf("error"))
+	target := &config.Target{Name: "probe4.example.com"}
+	if reason := CheckConnectivity(context.Background(), target, log.NewNopLogger()); reason != "" {
+		t.Errorf("Unexpected reason %s", reason)
+	}
+	if *calls != 0 {
+		t.Errorf("Unexpected probe calls %d", *calls)
+	}
+}
+
+func TestCircuitBreakerBackoff(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.probe.backoff=30s", "--collector.probe.max-backoff=2m"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = kingpin.CommandLine.Parse([]string{}) }()
+	b := &circuitBreaker{}
+	now := time.Now()
+	for i, expected := range []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 2 * time.Minute} {
+		if backoff := b.failure(now); backoff != expected {
+			t.Errorf("Unexpected backoff for failure %d, expected %v got %v", i+1, expected, backoff)
+		}
+	}
+	if !b.open(now.Add(time.Minute)) || b.open(now.Add(2*time.Minute)) {
+		t.Errorf("Unexpected circuit state")
+	}
+}
+
+func TestGate(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	calls := mockProbe(t, fmt.Errorf("ANS1017E Session rejected: TCP/IP connection failure."))
+	target := &config.Target{Name: "probe5.example.com", FallbackMaxStale: map[string]time.Duration{"db": time.Hour}}
+	good := getLastGood(target.Name, "db")
+	good.metrics = dataMetrics(gatherCollector(NewDBExporter(context.Background(), target, log.NewNopLogger())))
+	good.updated = time.Now()
+	tsmCollector := &TSMCollector{Collectors: map[string]Collector{
+		"log":    &cachedCollector{name: "log", cache: &collectorCache{}},
+		"status": NewStatusExporter(context.Background(), target, log.NewNopLogger()),
+		"db":     newFallbackCollector("db", NewDBExporter(context.Background(), target, log.NewNopLogger()), target),
+	}}
+	if reason := tsmCollector.Gate(context.Background(), target, log.NewNopLogger()); reason != ReasonError {
+		t.Errorf("Unexpected reason %s", reason)
+	}
+	if *calls != 1 {
+		t.Errorf("Unexpected probe calls %d", *calls)
+	}
+	if _, ok := tsmCollector.Collectors["log"].(*cachedCollector); !ok {
+		t.Errorf("Cached collector was not kept")
+	}
+	if _, ok := tsmCollector.Collectors["status"]; ok {
+		t.Errorf("Live collector was not skipped")
+	}
+	expected := `
+	# HELP tsm_exporter_collect_error Indicates if error has occurred during collection
+	# TYPE tsm_exporter_collect_error gauge
+	tsm_exporter_collect_error{collector="db"} 1
+	# HELP tsm_exporter_collector_stale Indicates the collector failed and the last successful results are served
+	# TYPE tsm_exporter_collector_stale gauge
+	tsm_exporter_collector_stale{collector="db"} 1
+	`
+	if err := testutil.GatherAndCompare(setupGatherer(tsmCollector.Collectors["db"]), strings.NewReader(expected),
+		"tsm_exporter_collect_error", "tsm_exporter_collector_stale"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestGateCached(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	calls := mockProbe(t, fmt.Errorf("error"))
+	target := &config.Target{Name: "probe6.example.com"}
+	tsmCollector := &TSMCollector{Collectors: map[string]Collector{
+		"log": &cachedCollector{name: "log", cache: &collectorCache{}},
+	}}
+	if reason := tsmCollector.Gate(context.Background(), target, log.NewNopLogger()); reason != "" {
+		t.Errorf("Unexpected reason %s", reason)
+	}
+	if *calls != 0 {
+		t.Errorf("Unexpected probe calls %d when all collectors are cached", *calls)
+	}
+}
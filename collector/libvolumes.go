@@ -40,6 +40,7 @@ type LibVolumeMetric struct {
 
 type LibVolumesCollector struct {
 	media  *prometheus.Desc
+	ctx    context.Context
 	target *config.Target
 	logger log.Logger
 }
@@ -48,10 +49,11 @@ func init() {
 	registerCollector("libvolumes", true, NewLibVolumesExporter)
 }
 
-func NewLibVolumesExporter(target *config.Target, logger log.Logger) Collector {
+func NewLibVolumesExporter(ctx context.Context, target *config.Target, logger log.Logger) Collector {
 	return &LibVolumesCollector{
 		media: prometheus.NewDesc(prometheus.BuildFQName(namespace, "libvolume", "media"),
 			"Number of tapes", []string{"mediatype", "library", "status"}, nil),
+		ctx:    ctx,
 		target: target,
 		logger: logger,
 	}
@@ -85,7 +87,7 @@ func (c *LibVolumesCollector) Collect(ch chan<- prometheus.Metric) {
 }
 
 func (c *LibVolumesCollector) collect() (map[string]LibVolumeMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*libvolumesTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(c.ctx, collectorTimeout(c.target, "libvolumes", *libvolumesTimeout))
 	defer cancel()
 	out, err := DsmadmcLibVolumesExec(c.target, ctx, c.logger)
 	if err != nil {
@@ -97,8 +99,8 @@ func (c *LibVolumesCollector) collect() (map[string]LibVolumeMetric, error) {
 
 func buildLibVolumesQuery(target *config.Target) string {
 	query := "SELECT MEDIATYPE,STATUS,LIBRARY_NAME,COUNT(*) FROM libvolumes"
-	if target.LibraryName != "" {
-		query = query + fmt.Sprintf(" WHERE LIBRARY_NAME='%s'", target.LibraryName)
+	if libraryName := target.Options("libvolumes").LibraryName; libraryName != "" {
+		query = query + fmt.Sprintf(" WHERE LIBRARY_NAME='%s'", libraryName)
 	}
 	query = query + " GROUP BY(MEDIATYPE,STATUS,LIBRARY_NAME)"
 	return query
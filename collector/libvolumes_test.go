@@ -98,7 +98,7 @@ func TestLibVolumesCollector(t *testing.T) {
 	tsm_libvolume_media{library="LIB1",mediatype="LTO-7",status="private"} 1082
 	tsm_libvolume_media{library="LIB1",mediatype="LTO-7",status="scratch"} 153
 	`
-	collector := NewLibVolumesExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewLibVolumesExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -127,7 +127,7 @@ func TestLibVolumesCollectorError(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="libvolumes"} 0
 	`
-	collector := NewLibVolumesExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewLibVolumesExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -156,7 +156,7 @@ func TestLibVolumesCollectorTimeout(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="libvolumes"} 1
 	`
-	collector := NewLibVolumesExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewLibVolumesExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
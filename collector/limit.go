@@ -0,0 +1,129 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+const (
+	queueGlobal = "global"
+	queueTarget = "target"
+)
+
+var (
+	maxConcurrent  = kingpin.Flag("dsmadmc.max-concurrent", "Maximum number of concurrent dsmadmc queries across all targets, 0 disables the limit").Default("0").Int64()
+	globalLimit    querySemaphore
+	targetLimits   = make(map[string]querySemaphore)
+	limitsLock     = sync.Mutex{}
+	queryQueueWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "dsmadmc_queue_wait_seconds",
+		Help:      "Time queries spent waiting for a dsmadmc query slot",
+		Buckets:   []float64{0.001, 0.01, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"target", "queue"})
+)
+
+func init() {
+	prometheus.MustRegister(queryQueueWait)
+}
+
+// querySemaphore limits the number of concurrent queries to its capacity
+type querySemaphore chan struct{}
+
+// acquire waits for a slot or until the context is done
+func (s querySemaphore) acquire(ctx context.Context) error {
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s querySemaphore) release() {
+	<-s
+}
+
+// getGlobalLimit returns the semaphore shared by all targets, nil if there is no limit
+func getGlobalLimit() querySemaphore {
+	limitsLock.Lock()
+	defer limitsLock.Unlock()
+	if *maxConcurrent <= 0 {
+		return nil
+	}
+	if globalLimit == nil || int64(cap(globalLimit)) != *maxConcurrent {
+		globalLimit = make(querySemaphore, *maxConcurrent)
+	}
+	return globalLimit
+}
+
+// getTargetLimit returns the semaphore of a target, nil if the target has no limit
+func getTargetLimit(target *config.Target) querySemaphore {
+	limitsLock.Lock()
+	defer limitsLock.Unlock()
+	if target.MaxSessions <= 0 {
+		delete(targetLimits, target.Name)
+		return nil
+	}
+	limit, ok := targetLimits[target.Name]
+	if !ok || cap(limit) != target.MaxSessions {
+		limit = make(querySemaphore, target.MaxSessions)
+		targetLimits[target.Name] = limit
+	}
+	return limit
+}
+
+// acquireQuerySlot waits for the target's and then the global query limit.
+// Time spent waiting counts against the context deadline. The returned function releases the slots.
+func acquireQuerySlot(ctx context.Context, target *config.Target, logger log.Logger) (func(), error) {
+	var held []func()
+	release := func() {
+		for _, r := range held {
+			r()
+		}
+	}
+	for _, queue := range []string{queueTarget, queueGlobal} {
+		var limit querySemaphore
+		if queue == queueTarget {
+			limit = getTargetLimit(target)
+		} else {
+			limit = getGlobalLimit()
+		}
+		if limit == nil {
+			continue
+		}
+		start := time.Now()
+		err := limit.acquire(ctx)
+		queryQueueWait.WithLabelValues(target.Name, queue).Observe(time.Since(start).Seconds())
+		if err != nil {
+			release()
+			if err == context.DeadlineExceeded {
+				level.Error(logger).Log("msg", "Timeout waiting for dsmadmc query slot", "queue", queue)
+			}
+			return nil, err
+		}
+		held = append(held, limit.release)
+	}
+	return release, nil
+}
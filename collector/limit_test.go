@@ -0,0 +1,80 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+func TestQuerySemaphore(t *testing.T) {
+	s := make(querySemaphore, 1)
+	ctx := context.Background()
+	if err := s.acquire(ctx); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := s.acquire(timeoutCtx); err != context.DeadlineExceeded {
+		t.Errorf("Expected timeout, got %v", err)
+	}
+	s.release()
+	if err := s.acquire(ctx); err != nil {
+		t.Errorf("Unexpected error after release: %s", err)
+	}
+	s.release()
+	if len(s) != 0 {
+		t.Errorf("Unexpected semaphore value %d", len(s))
+	}
+}
+
+func TestAcquireQuerySlot(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--dsmadmc.max-concurrent=2"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = kingpin.CommandLine.Parse([]string{}) }()
+	target := &config.Target{Name: "limit.example.com", MaxSessions: 1}
+	other := &config.Target{Name: "limit2.example.com"}
+	ctx := context.Background()
+	release, err := acquireQuerySlot(ctx, target, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := acquireQuerySlot(timeoutCtx, target, log.NewNopLogger()); err != context.DeadlineExceeded {
+		t.Errorf("Expected timeout waiting for target slot, got %v", err)
+	}
+	releaseOther, err := acquireQuerySlot(ctx, other, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, err := acquireQuerySlot(timeoutCtx, other, log.NewNopLogger()); err != context.DeadlineExceeded {
+		t.Errorf("Expected timeout waiting for global slot, got %v", err)
+	}
+	release()
+	releaseOther()
+	if len(getGlobalLimit()) != 0 || len(getTargetLimit(target)) != 0 {
+		t.Errorf("Query slots were not released")
+	}
+	if val := testutil.CollectAndCount(queryQueueWait, "tsm_exporter_dsmadmc_queue_wait_seconds"); val != 3 {
+		t.Errorf("Unexpected queue wait histograms %d, expected 3", val)
+	}
+}
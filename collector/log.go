@@ -48,6 +48,7 @@ type LogCollector struct {
 	Total  *prometheus.Desc
 	Used   *prometheus.Desc
 	Free   *prometheus.Desc
+	ctx    context.Context
 	target *config.Target
 	logger log.Logger
 }
@@ -56,7 +57,7 @@ func init() {
 	registerCollector("log", true, NewLogExporter)
 }
 
-func NewLogExporter(target *config.Target, logger log.Logger) Collector {
+func NewLogExporter(ctx context.Context, target *config.Target, logger log.Logger) Collector {
 	return &LogCollector{
 		Total: prometheus.NewDesc(prometheus.BuildFQName(namespace, "active_log", "total_bytes"),
 			"Active log total space in bytes", nil, nil),
@@ -64,6 +65,7 @@ func NewLogExporter(target *config.Target, logger log.Logger) Collector {
 			"Active log used space in bytes", nil, nil),
 		Free: prometheus.NewDesc(prometheus.BuildFQName(namespace, "active_log", "free_bytes"),
 			"Active log free space in bytes", nil, nil),
+		ctx:    ctx,
 		target: target,
 		logger: logger,
 	}
@@ -100,7 +102,7 @@ func (c *LogCollector) Collect(ch chan<- prometheus.Metric) {
 }
 
 func (c *LogCollector) collect() (LogMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*logTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(c.ctx, collectorTimeout(c.target, "log", *logTimeout))
 	defer cancel()
 	out, err := DsmadmcLogExec(c.target, ctx, c.logger)
 	if err != nil {
@@ -95,7 +95,7 @@ func TestLogCollector(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="log"} 0
 	`
-	collector := NewLogExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewLogExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -124,7 +124,7 @@ func TestLogCollectorError(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="log"} 0
 	`
-	collector := NewLogExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewLogExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -153,7 +153,7 @@ func TestLogCollectorTimeout(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="log"} 1
 	`
-	collector := NewLogExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewLogExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
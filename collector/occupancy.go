@@ -59,6 +59,7 @@ type OccupancysCollector struct {
 	logical   *prometheus.Desc
 	reporting *prometheus.Desc
 	files     *prometheus.Desc
+	ctx       context.Context
 	target    *config.Target
 	logger    log.Logger
 }
@@ -67,7 +68,7 @@ func init() {
 	registerCollector("occupancy", true, NewOccupancysExporter)
 }
 
-func NewOccupancysExporter(target *config.Target, logger log.Logger) Collector {
+func NewOccupancysExporter(ctx context.Context, target *config.Target, logger log.Logger) Collector {
 	return &OccupancysCollector{
 		physical: prometheus.NewDesc(prometheus.BuildFQName(namespace, "occupancy", "physical_bytes"),
 			"Physical space occupied", []string{"nodename", "filespace", "storagepool"}, nil),
@@ -77,6 +78,7 @@ func NewOccupancysExporter(target *config.Target, logger log.Logger) Collector {
 			"Reporting space occupied", []string{"nodename", "filespace", "storagepool"}, nil),
 		files: prometheus.NewDesc(prometheus.BuildFQName(namespace, "occupancy", "files"),
 			"Number of files", []string{"nodename", "filespace", "storagepool"}, nil),
+		ctx:    ctx,
 		target: target,
 		logger: logger,
 	}
@@ -123,7 +125,7 @@ func (c *OccupancysCollector) Collect(ch chan<- prometheus.Metric) {
 }
 
 func (c *OccupancysCollector) collect() ([]OccupancyMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*occupancyTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(c.ctx, collectorTimeout(c.target, "occupancy", *occupancyTimeout))
 	defer cancel()
 	out, err := DsmadmcOccupancysExec(c.target, ctx, c.logger)
 	if err != nil {
@@ -115,7 +115,7 @@ func TestOccupancysCollector(t *testing.T) {
 	tsm_occupancy_reporting_bytes{filespace="/home",nodename="NETAPPUSER",storagepool="PFNETAPP"} 60817408
 	tsm_occupancy_reporting_bytes{filespace="/usr/exploit",nodename="MORGON",storagepool="CLOUDTSMAZ"} 1048576000
 	`
-	collector := NewOccupancysExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewOccupancysExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -145,7 +145,7 @@ func TestOccupancysCollectorError(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="occupancy"} 0
 	`
-	collector := NewOccupancysExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewOccupancysExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -174,7 +174,7 @@ func TestOccupancysCollectorTimeout(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="occupancy"} 1
 	`
-	collector := NewOccupancysExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewOccupancysExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
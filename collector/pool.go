@@ -0,0 +1,398 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+var (
+	poolSize           = kingpin.Flag("dsmadmc.pool.size", "Number of persistent dsmadmc console sessions per target, 0 disables session pooling").Default("0").Int()
+	poolIdleTimeout    = kingpin.Flag("dsmadmc.pool.idle-timeout", "Close pooled dsmadmc sessions that have been idle for this duration").Default("5m").Duration()
+	poolHealthInterval = kingpin.Flag("dsmadmc.pool.health-interval", "Interval to health check idle pooled dsmadmc sessions").Default("1m").Duration()
+	poolHealthTimeout  = 10 * time.Second
+	pools              = make(map[string]*dsmadmcPool)
+	poolsLock          = sync.Mutex{}
+	closingSessions    sync.WaitGroup
+	consolePrompt      = regexp.MustCompile(`^(\S+: \S+> ?)+`)
+	consoleMessage     = regexp.MustCompile(`^AN[RS][0-9]{4}([IEWS])`)
+	poolSessions       = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "dsmadmc_pool_sessions_open",
+		Help:      "Number of open pooled dsmadmc sessions",
+	}, []string{"target"})
+	poolQueries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "dsmadmc_pool_queries_total",
+		Help:      "Number of queries served by pooled dsmadmc sessions",
+	}, []string{"target"})
+	poolRespawns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "dsmadmc_pool_respawns_total",
+		Help:      "Number of pooled dsmadmc sessions started to replace failed sessions",
+	}, []string{"target"})
+)
+
+func init() {
+	prometheus.MustRegister(poolSessions)
+	prometheus.MustRegister(poolQueries)
+	prometheus.MustRegister(poolRespawns)
+}
+
+type dsmadmcSession struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	stdout   *bufio.Reader
+	target   string
+	seq      int
+	lastUsed time.Time
+	dead     bool
+	closed   bool
+}
+
+type dsmadmcPool struct {
+	sync.Mutex
+	target *config.Target
+	sem    chan struct{}
+	idle   []*dsmadmcSession
+	failed int
+	closed bool
+	stop   chan struct{}
+	logger log.Logger
+}
+
+// getPool returns the session pool for a target, replacing the pool if the target was reloaded.
+// Module copies of a target share the pool of their base target.
+func getPool(target *config.Target, logger log.Logger) *dsmadmcPool {
+	target = target.Base()
+	poolsLock.Lock()
+	defer poolsLock.Unlock()
+	pool, ok := pools[target.Name]
+	if ok && pool.target == target {
+		return pool
+	}
+	if ok {
+		pool.close()
+	}
+	pool = &dsmadmcPool{
+		target: target,
+		sem:    make(chan struct{}, *poolSize),
+		stop:   make(chan struct{}),
+		logger: log.With(logger, "pool", target.Name),
+	}
+	pools[target.Name] = pool
+	go pool.maintain(*poolHealthInterval)
+	return pool
+}
+
+func (p *dsmadmcPool) query(ctx context.Context, query string, logger log.Logger) (string, error) {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-p.sem }()
+	session, err := p.get(ctx)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			level.Error(logger).Log("msg", "Timeout starting dsmadmc session")
+			return "", ctx.Err()
+		}
+		level.Error(logger).Log("msg", "Error starting dsmadmc session", "err", err)
+		return "", err
+	}
+	level.Debug(logger).Log("msg", "dsmadmc pooled query", "query", query)
+	out, err := session.query(ctx, query)
+	poolQueries.WithLabelValues(p.target.Name).Inc()
+	p.put(session, true)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			level.Error(logger).Log("msg", "Timeout executing dsmadmc")
+			return "", ctx.Err()
+		}
+		level.Error(logger).Log("msg", "Error executing dsmadmc", "err", err)
+		return "", err
+	}
+	level.Debug(logger).Log("msg", "query output", "out", out)
+	return out, nil
+}
+
+func (p *dsmadmcPool) get(ctx context.Context) (*dsmadmcSession, error) {
+	p.Lock()
+	if n := len(p.idle); n > 0 {
+		session := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.Unlock()
+		return session, nil
+	}
+	respawn := p.failed > 0
+	if respawn {
+		p.failed--
+	}
+	p.Unlock()
+	session, err := startSession(ctx, p.target)
+	if err != nil {
+		p.Lock()
+		p.failed++
+		p.Unlock()
+		return nil, err
+	}
+	if respawn {
+		level.Info(p.logger).Log("msg", "Respawned dsmadmc session")
+		poolRespawns.WithLabelValues(p.target.Name).Inc()
+	}
+	return session, nil
+}
+
+func (p *dsmadmcPool) put(session *dsmadmcSession, used bool) {
+	p.Lock()
+	defer p.Unlock()
+	if session.dead {
+		p.failed++
+		session.close()
+		return
+	}
+	if p.closed || len(p.idle) >= cap(p.sem) {
+		session.close()
+		return
+	}
+	if used {
+		session.lastUsed = time.Now()
+	}
+	p.idle = append(p.idle, session)
+}
+
+func (p *dsmadmcPool) maintain(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.expire(time.Now())
+			p.healthCheck()
+		}
+	}
+}
+
+// expire closes sessions that have been idle longer than the idle timeout
+func (p *dsmadmcPool) expire(now time.Time) {
+	p.Lock()
+	defer p.Unlock()
+	var idle []*dsmadmcSession
+	for _, session := range p.idle {
+		if now.Sub(session.lastUsed) > *poolIdleTimeout {
+			level.Debug(p.logger).Log("msg", "Closing idle dsmadmc session")
+			session.close()
+			continue
+		}
+		idle = append(idle, session)
+	}
+	p.idle = idle
+}
+
+// healthCheck checks the idle sessions one at a time, the session being checked holds a query slot
+// so that concurrent queries do not start more sessions than the pool size
+func (p *dsmadmcPool) healthCheck() {
+	p.Lock()
+	n := len(p.idle)
+	p.Unlock()
+	for i := 0; i < n; i++ {
+		select {
+		case p.sem <- struct{}{}:
+		case <-p.stop:
+			return
+		}
+		p.Lock()
+		if len(p.idle) == 0 {
+			p.Unlock()
+			<-p.sem
+			return
+		}
+		// Checked sessions are put back at the end of the idle list
+		session := p.idle[0]
+		p.idle = p.idle[1:]
+		p.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), poolHealthTimeout)
+		_, err := session.query(ctx, "")
+		cancel()
+		if err != nil {
+			level.Error(p.logger).Log("msg", "dsmadmc session failed health check", "err", err)
+			session.dead = true
+		}
+		p.put(session, false)
+		<-p.sem
+	}
+}
+
+func (p *dsmadmcPool) close() {
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.stop)
+	for _, session := range p.idle {
+		session.close()
+	}
+	p.idle = nil
+}
+
+// ClosePools closes the session pools of all targets and waits for their dsmadmc sessions to exit
+func ClosePools() {
+	poolsLock.Lock()
+	for name, pool := range pools {
+		pool.close()
+		delete(pools, name)
+	}
+	poolsLock.Unlock()
+	closingSessions.Wait()
+}
+
+func startSession(ctx context.Context, target *config.Target) (*dsmadmcSession, error) {
+	cmd := dsmadmcCommand(context.Background(), target, dsmadmcArgs(target)...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	poolSessions.WithLabelValues(target.Name).Inc()
+	session := &dsmadmcSession{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+		target: target.Name,
+	}
+	// Run only the end marker query to confirm the session logged in
+	if _, err := session.query(ctx, ""); err != nil {
+		session.close()
+		return nil, err
+	}
+	return session, nil
+}
+
+// query sends the query followed by a SELECT of a unique marker so the end of the query output can be found
+func (s *dsmadmcSession) query(ctx context.Context, query string) (string, error) {
+	s.seq++
+	marker := fmt.Sprintf("TSM_EXPORTER_END_%d", s.seq)
+	var lines, errors []string
+	var err error
+	noMatch := false
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		input := fmt.Sprintf("SELECT '%s' FROM status\n", marker)
+		if query != "" {
+			input = query + "\n" + input
+		}
+		if _, err = io.WriteString(s.stdin, input); err != nil {
+			return
+		}
+		for {
+			var line string
+			line, err = s.stdout.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = consolePrompt.ReplaceAllString(strings.TrimRight(line, "\r\n"), "")
+			if line == marker {
+				return
+			}
+			if line == "" {
+				continue
+			}
+			if strings.Contains(line, "No match found using this criteria") {
+				noMatch = true
+				continue
+			}
+			if m := consoleMessage.FindStringSubmatch(line); m != nil {
+				if m[1] == "E" || m[1] == "S" {
+					errors = append(errors, line)
+				}
+				continue
+			}
+			lines = append(lines, line)
+		}
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// The reader stops once the killed session's output is closed, waiting on it would wait for a SIGKILL
+		s.dead = true
+		s.kill()
+		return "", ctx.Err()
+	}
+	if err != nil {
+		s.dead = true
+		return "", fmt.Errorf("dsmadmc session ended: %s", err)
+	}
+	if noMatch {
+		return "", nil
+	}
+	if len(errors) > 0 {
+		return "", fmt.Errorf("%s", strings.Join(errors, "; "))
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+func (s *dsmadmcSession) kill() {
+	_ = terminateProcessGroup(s.cmd.Process.Pid, s.target, *killGracePeriod)
+}
+
+func (s *dsmadmcSession) close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	poolSessions.WithLabelValues(s.target).Dec()
+	closingSessions.Add(1)
+	go func() {
+		defer closingSessions.Done()
+		if !s.dead {
+			_, _ = io.WriteString(s.stdin, "quit\n")
+		}
+		s.stdin.Close()
+		timer := time.AfterFunc(5*time.Second, s.kill)
+		_ = s.cmd.Wait()
+		timer.Stop()
+	}()
+}
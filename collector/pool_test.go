@@ -0,0 +1,232 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+func setupPool(t *testing.T, name string) (*config.Target, func()) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--dsmadmc.pool.size=2"}); err != nil {
+		t.Fatal(err)
+	}
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "SP03,foo\nSP04,bar\n"
+	target := &config.Target{Name: name, Servername: "tsm1", Id: "admin", Password: "secret"}
+	return target, func() {
+		execCommand = exec.CommandContext
+		poolsLock.Lock()
+		if pool, ok := pools[name]; ok {
+			pool.close()
+			delete(pools, name)
+		}
+		poolsLock.Unlock()
+		poolSessions.DeleteLabelValues(name)
+		poolQueries.DeleteLabelValues(name)
+		poolRespawns.DeleteLabelValues(name)
+		if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDsmadmcQueryPool(t *testing.T) {
+	target, cleanup := setupPool(t, "pool1")
+	defer cleanup()
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		out, err := dsmadmcQuery(target, "SELECT * FROM foo", ctx, log.NewNopLogger())
+		cancel()
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err.Error())
+		}
+		if out != mockedStdout {
+			t.Errorf("Unexpected out: %q", out)
+		}
+	}
+	if val := testutil.ToFloat64(poolQueries.WithLabelValues("pool1")); val != 3 {
+		t.Errorf("Unexpected queries count, got %v", val)
+	}
+	if val := testutil.ToFloat64(poolSessions.WithLabelValues("pool1")); val != 1 {
+		t.Errorf("Unexpected sessions open, got %v", val)
+	}
+}
+
+func TestDsmadmcQueryPoolErrors(t *testing.T) {
+	target, cleanup := setupPool(t, "pool2")
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := dsmadmcQuery(target, "error", ctx, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	} else if err.Error() != "ANR2000E Unknown command - ERROR." {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	out, err := dsmadmcQuery(target, "nomatch", ctx, log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != "" {
+		t.Errorf("Unexpected out: %q", out)
+	}
+	if _, err := dsmadmcQuery(target, "crash", ctx, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+	if _, err := dsmadmcQuery(target, "query", ctx, log.NewNopLogger()); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if val := testutil.ToFloat64(poolRespawns.WithLabelValues("pool2")); val != 1 {
+		t.Errorf("Unexpected respawn count, got %v", val)
+	}
+	if val := testutil.ToFloat64(poolSessions.WithLabelValues("pool2")); val != 1 {
+		t.Errorf("Unexpected sessions open, got %v", val)
+	}
+}
+
+func TestDsmadmcQueryPoolTimeout(t *testing.T) {
+	target, cleanup := setupPool(t, "pool3")
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if _, err := dsmadmcQuery(target, "query", ctx, log.NewNopLogger()); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	cancel()
+	ctx, cancel = context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err := dsmadmcQuery(target, "hang", ctx, log.NewNopLogger())
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected timeout, got %v", err)
+	}
+	if val := testutil.ToFloat64(poolSessions.WithLabelValues("pool3")); val != 0 {
+		t.Errorf("Unexpected sessions open, got %v", val)
+	}
+}
+
+func TestDsmadmcPoolExpire(t *testing.T) {
+	target, cleanup := setupPool(t, "pool4")
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := dsmadmcQuery(target, "query", ctx, log.NewNopLogger()); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	pool := getPool(target, log.NewNopLogger())
+	pool.healthCheck()
+	if val := testutil.ToFloat64(poolSessions.WithLabelValues("pool4")); val != 1 {
+		t.Errorf("Unexpected sessions open after health check, got %v", val)
+	}
+	pool.expire(time.Now().Add(*poolIdleTimeout + time.Second))
+	if val := testutil.ToFloat64(poolSessions.WithLabelValues("pool4")); val != 0 {
+		t.Errorf("Unexpected sessions open after expire, got %v", val)
+	}
+}
+
+func TestDsmadmcPoolSize(t *testing.T) {
+	target, cleanup := setupPool(t, "pool5")
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pool := getPool(target, log.NewNopLogger())
+	var sessions []*dsmadmcSession
+	for i := 0; i < 3; i++ {
+		session, err := startSession(ctx, target)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		sessions = append(sessions, session)
+	}
+	for _, session := range sessions {
+		pool.put(session, true)
+	}
+	if len(pool.idle) != 2 {
+		t.Errorf("Unexpected idle sessions %d, expected 2", len(pool.idle))
+	}
+	if val := testutil.ToFloat64(poolSessions.WithLabelValues("pool5")); val != 2 {
+		t.Errorf("Unexpected sessions open, got %v", val)
+	}
+	// A session being health checked holds a query slot
+	pool.sem <- struct{}{}
+	pool.sem <- struct{}{}
+	done := make(chan struct{})
+	go func() {
+		pool.healthCheck()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatalf("Health check ran while the pool was busy")
+	case <-time.After(200 * time.Millisecond):
+	}
+	<-pool.sem
+	<-pool.sem
+	<-done
+	if len(pool.idle) != 2 {
+		t.Errorf("Unexpected idle sessions %d after health check, expected 2", len(pool.idle))
+	}
+}
+
+func TestDsmadmcPoolModuleTarget(t *testing.T) {
+	target, cleanup := setupPool(t, "pool6")
+	defer cleanup()
+	module := target.WithModule("nightly", &config.Module{Collectors: []string{"occupancy"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pool := getPool(target, log.NewNopLogger())
+	for i, queryTarget := range []*config.Target{target, module, target, module} {
+		if _, err := dsmadmcQuery(queryTarget, "query", ctx, log.NewNopLogger()); err != nil {
+			t.Errorf("Unexpected error in query %d: %s", i, err.Error())
+		}
+	}
+	if getPool(module, log.NewNopLogger()) != pool {
+		t.Errorf("Module target did not reuse the pool of its base target")
+	}
+	if val := testutil.ToFloat64(poolSessions.WithLabelValues("pool6")); val != 1 {
+		t.Errorf("Unexpected sessions open, got %v", val)
+	}
+	if val := testutil.ToFloat64(poolQueries.WithLabelValues("pool6")); val != 4 {
+		t.Errorf("Unexpected queries count, got %v", val)
+	}
+}
+
+func TestClosePools(t *testing.T) {
+	target, cleanup := setupPool(t, "pool7")
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := dsmadmcQuery(target, "query", ctx, log.NewNopLogger()); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	session := getPool(target, log.NewNopLogger()).idle[0]
+	ClosePools()
+	if session.cmd.ProcessState == nil {
+		t.Errorf("dsmadmc session is still running")
+	}
+	if val := testutil.ToFloat64(poolSessions.WithLabelValues("pool7")); val != 0 {
+		t.Errorf("Unexpected sessions open, got %v", val)
+	}
+	poolsLock.Lock()
+	defer poolsLock.Unlock()
+	if len(pools) != 0 {
+		t.Errorf("Unexpected pools %v", pools)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	killGracePeriod = kingpin.Flag("dsmadmc.kill-grace-period", "Time to wait after sending SIGTERM to a canceled dsmadmc process group before sending SIGKILL").Default("5s").Duration()
+	forcedKills     = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "dsmadmc_forced_kills_total",
+		Help:      "Number of dsmadmc process groups killed with SIGKILL after not exiting on SIGTERM",
+	}, []string{"target"})
+)
+
+func init() {
+	prometheus.MustRegister(forcedKills)
+}
+
+// setProcessGroup starts cmd in its own process group that is terminated as a whole when the command's context is done
+func setProcessGroup(cmd *exec.Cmd, target string) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	gracePeriod := *killGracePeriod
+	cmd.Cancel = func() error {
+		return terminateProcessGroup(cmd.Process.Pid, target, gracePeriod)
+	}
+	// Backstop for pipes held open by processes that escaped the process group
+	cmd.WaitDelay = 2 * gracePeriod
+}
+
+// terminateProcessGroup sends SIGTERM to a process group and SIGKILL if any process
+// of the group is still running after the grace period, by default the --dsmadmc.kill-grace-period
+func terminateProcessGroup(pgid int, target string, gracePeriod time.Duration) error {
+	if err := syscall.Kill(-pgid, syscall.SIGTERM); err == syscall.ESRCH {
+		return os.ErrProcessDone
+	} else if err != nil {
+		return err
+	}
+	time.AfterFunc(gracePeriod, func() {
+		if syscall.Kill(-pgid, 0) != nil {
+			return
+		}
+		if syscall.Kill(-pgid, syscall.SIGKILL) == nil {
+			forcedKills.WithLabelValues(target).Inc()
+		}
+	})
+	return nil
+}
+
+// runProcess calls run, which runs a command created with ctx, and returns ctx.Err() as soon as ctx is done
+// instead of waiting for the process group to exit. The command's context terminates the process group and the
+// process is reaped in the background, so the command's output must not be read unless the process exited.
+func runProcess(ctx context.Context, run func() error) (bool, error) {
+	done := make(chan error, 1)
+	go func() {
+		done <- run()
+	}()
+	select {
+	case err := <-done:
+		return true, err
+	case <-ctx.Done():
+		select {
+		case err := <-done:
+			return true, err
+		default:
+		}
+		return false, ctx.Err()
+	}
+}
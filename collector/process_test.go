@@ -0,0 +1,102 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+func runProcessGroup(t *testing.T, script string, target string) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--dsmadmc.kill-grace-period=100ms"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _, _ = kingpin.CommandLine.Parse([]string{}) })
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, "sh", "-c", script)
+	setProcessGroup(cmd, target)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Process group was not terminated")
+	}
+	// Wait for the SIGKILL escalation
+	time.Sleep(300 * time.Millisecond)
+}
+
+func TestProcessGroupTerminated(t *testing.T) {
+	runProcessGroup(t, "exec sleep 30", "term.example.com")
+	if val := testutil.ToFloat64(forcedKills.WithLabelValues("term.example.com")); val != 0 {
+		t.Errorf("Unexpected forced kills %v", val)
+	}
+}
+
+func TestProcessGroupForcedKill(t *testing.T) {
+	runProcessGroup(t, "trap '' TERM; sleep 30 & wait", "kill.example.com")
+	if val := testutil.ToFloat64(forcedKills.WithLabelValues("kill.example.com")); val != 1 {
+		t.Errorf("Unexpected forced kills %v, expected 1", val)
+	}
+}
+
+func TestDsmadmcExecIgnoresTerm(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--dsmadmc.kill-grace-period=1s"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _, _ = kingpin.CommandLine.Parse([]string{}) })
+	dsmadmc := filepath.Join(t.TempDir(), "dsmadmc")
+	if err := os.WriteFile(dsmadmc, []byte("#!/bin/sh\ntrap '' TERM\nsleep 30 & wait\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	target := &config.Target{Name: "ignoreterm.example.com", Servername: "tsm1", DsmadmcPath: dsmadmc}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := dsmadmcExec(target, "query", ctx, log.NewNopLogger())
+	if err != context.DeadlineExceeded {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("dsmadmc returned after %s, expected it to return at the context deadline", elapsed)
+	}
+	// Wait for the SIGKILL escalation
+	time.Sleep(1500 * time.Millisecond)
+	if val := testutil.ToFloat64(forcedKills.WithLabelValues("ignoreterm.example.com")); val != 1 {
+		t.Errorf("Unexpected forced kills %v, expected 1", val)
+	}
+}
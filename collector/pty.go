@@ -0,0 +1,79 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/creack/pty"
+)
+
+var (
+	passwordPrompt = regexp.MustCompile(`(?i)enter (your )?password:\s*$`)
+)
+
+// ptyRun runs cmd under a pseudo-terminal and answers the dsmadmc password prompt
+// so the password is never passed as a command line argument.
+// Output written after the prompt is stored in stdout.
+func ptyRun(cmd *exec.Cmd, password string, stdout *bytes.Buffer) error {
+	// The pseudo-terminal session makes cmd a process group leader, setting the process group as well would fail
+	if cmd.SysProcAttr != nil {
+		cmd.SysProcAttr.Setpgid = false
+	}
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return err
+	}
+	defer ptmx.Close()
+	var out bytes.Buffer
+	promptSeen := false
+	buf := make([]byte, 4096)
+	for {
+		n, err := ptmx.Read(buf)
+		if n > 0 {
+			out.Write(buf[:n])
+			if !promptSeen && passwordPrompt.Match(out.Bytes()) {
+				promptSeen = true
+				out.Reset()
+				if _, err := ptmx.Write([]byte(password + "\n")); err != nil {
+					break
+				}
+			}
+		}
+		// Reading the pty returns an error once dsmadmc exits and closes the terminal
+		if err != nil {
+			break
+		}
+	}
+	err = cmd.Wait()
+	stdout.WriteString(ptyOutput(out.String(), password))
+	return err
+}
+
+// ptyOutput removes terminal line endings and any echo of the password
+func ptyOutput(out string, password string) string {
+	out = strings.ReplaceAll(out, "\r\n", "\n")
+	lines := strings.SplitAfter(out, "\n")
+	for len(lines) > 0 {
+		line := strings.TrimRight(lines[0], "\r\n")
+		if line != "" && line != password {
+			break
+		}
+		lines = lines[1:]
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+func TestDsmadmcQueryPty(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "SP03,foo\nSP04,bar\n"
+	mockedPassword = "secret"
+	defer func() {
+		execCommand = exec.CommandContext
+		mockedPassword = ""
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	target := &config.Target{Id: "admin", Password: "secret", Login: config.LoginPty}
+	out, err := dsmadmcQuery(target, "query", ctx, log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != mockedStdout {
+		t.Errorf("Unexpected out: %q", out)
+	}
+}
+
+func TestDsmadmcQueryPtyBadPassword(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "SP03,foo\n"
+	mockedPassword = "secret"
+	defer func() {
+		execCommand = exec.CommandContext
+		mockedPassword = ""
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	target := &config.Target{Id: "admin", Password: "wrong", Login: config.LoginPty}
+	if _, err := dsmadmcQuery(target, "query", ctx, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+}
+
+func TestPtyOutput(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output string
+	}{
+		{Input: "\r\nSP03,foo\r\nSP04,bar\r\n", Output: "SP03,foo\nSP04,bar\n"},
+		{Input: "secret\r\nSP03,foo\r\n", Output: "SP03,foo\n"},
+		{Input: "", Output: ""},
+	}
+	for i, test := range tests {
+		if out := ptyOutput(test.Input, "secret"); out != test.Output {
+			t.Errorf("Unexpected output in case %d:\nExpected: %q\nGot: %q", i, test.Output, out)
+		}
+	}
+}
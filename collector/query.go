@@ -0,0 +1,169 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+type QueryMetric struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	value     float64
+	labels    []string
+}
+
+// QueryCollector exposes the results of a user defined query from the 'queries' config
+type QueryCollector struct {
+	query  *config.Query
+	descs  map[string]*prometheus.Desc
+	ctx    context.Context
+	target *config.Target
+	logger log.Logger
+}
+
+func NewQueryExporter(ctx context.Context, query *config.Query, target *config.Target, logger log.Logger) Collector {
+	descs := make(map[string]*prometheus.Desc)
+	for _, value := range query.Values {
+		descs[value.Column] = prometheus.NewDesc(prometheus.BuildFQName(namespace, "query", query.Name+"_"+value.Metric),
+			value.Help, query.Labels, nil)
+	}
+	return &QueryCollector{
+		query:  query,
+		descs:  descs,
+		ctx:    ctx,
+		target: target,
+		logger: logger,
+	}
+}
+
+func (c *QueryCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+func (c *QueryCollector) Collect(ch chan<- prometheus.Metric) {
+	level.Debug(c.logger).Log("msg", "Collecting metrics")
+	collectTime := time.Now()
+	timeout := 0
+	errorMetric := 0
+	metrics, err := c.collect()
+	if err == context.DeadlineExceeded {
+		timeout = 1
+	} else if err != nil {
+		level.Error(c.logger).Log("msg", err)
+		errorMetric = 1
+	}
+
+	for _, m := range metrics {
+		ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, m.value, m.labels...)
+	}
+
+	ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, float64(errorMetric), c.query.Name)
+	ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, float64(timeout), c.query.Name)
+	ch <- prometheus.MustNewConstMetric(collectDuration, prometheus.GaugeValue, time.Since(collectTime).Seconds(), c.query.Name)
+}
+
+func (c *QueryCollector) collect() ([]QueryMetric, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, collectorTimeout(c.target, c.query.Name, c.query.Timeout))
+	defer cancel()
+	out, err := dsmadmcQuery(c.target, c.query.Query, ctx, c.logger)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := c.parse(out)
+	return metrics, err
+}
+
+func (c *QueryCollector) parse(out string) ([]QueryMetric, error) {
+	var metrics []QueryMetric
+	records, err := getRecords(out, c.logger)
+	if err != nil {
+		return nil, err
+	}
+	invalid := 0
+	duplicate := 0
+	seen := make(map[string]bool)
+	for _, record := range records {
+		if len(record) != len(c.query.Columns) {
+			level.Error(c.logger).Log("msg", "Query row does not match the query columns", "columns", len(c.query.Columns), "record", strings.Join(record, ","))
+			invalid++
+			continue
+		}
+		var labels []string
+		for _, label := range c.query.Labels {
+			labels = append(labels, record[c.query.ColumnIndex(label)])
+		}
+		// Rows with the same labels would be duplicate series that fail the whole scrape
+		key := strings.Join(labels, "\xff")
+		if seen[key] {
+			level.Error(c.logger).Log("msg", "Query row has the same labels as a previous row", "record", strings.Join(record, ","))
+			duplicate++
+			continue
+		}
+		seen[key] = true
+		for _, value := range c.query.Values {
+			v := record[c.query.ColumnIndex(value.Column)]
+			metric := QueryMetric{desc: c.descs[value.Column], valueType: prometheus.GaugeValue, labels: labels}
+			if value.Type == config.ValueTimestamp {
+				if v == "" {
+					continue
+				}
+				t, err := parseTime(v, c.target)
+				if err != nil {
+					level.Error(c.logger).Log("msg", "Error parsing timestamp", "column", value.Column, "value", v, "record", strings.Join(record, ","), "err", err)
+					return nil, err
+				}
+				metric.value = float64(t.Unix())
+				metrics = append(metrics, metric)
+				continue
+			}
+			f, err := parseFloat(v)
+			if err != nil {
+				level.Error(c.logger).Log("msg", "Error parsing value", "column", value.Column, "value", v, "record", strings.Join(record, ","), "err", err)
+				return nil, err
+			}
+			if math.IsNaN(f) {
+				continue
+			}
+			switch value.Type {
+			case config.ValueCounter:
+				metric.valueType = prometheus.CounterValue
+			case config.ValueMBToBytes:
+				f = f * 1024 * 1024
+			case config.ValuePercentToRatio:
+				f = f / 100
+			}
+			metric.value = f
+			metrics = append(metrics, metric)
+		}
+	}
+	if invalid > 0 {
+		return metrics, fmt.Errorf("Query %s returned %d rows that do not have %d columns", c.query.Name, invalid, len(c.query.Columns))
+	}
+	if duplicate > 0 {
+		return metrics, fmt.Errorf("Query %s returned %d rows with the same labels as a previous row", c.query.Name, duplicate)
+	}
+	return metrics, nil
+}
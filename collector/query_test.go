@@ -0,0 +1,228 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+const queryConfig = `
+targets:
+  tsm1.example.com:
+    id: somwell
+    password: secret
+    timezone: UTC
+queries:
+  - name: node_occupancy
+    query: SELECT NODE_NAME,STGPOOL_NAME,SUM(LOGICAL_MB),SUM(NUM_FILES),PCT_UTILIZED,LAST_BACKUP,SESSIONS FROM occupancy
+    columns: [node, stgpool, logical_mb, files, pct_utilized, last_backup, sessions]
+    labels: [node, stgpool]
+    values:
+      - column: logical_mb
+        metric: logical_bytes
+        type: mb_to_bytes
+        help: Logical space occupied
+      - column: files
+      - column: pct_utilized
+        metric: utilized_ratio
+        type: percent_to_ratio
+      - column: last_backup
+        metric: last_backup_timestamp_seconds
+        type: timestamp
+      - column: sessions
+        metric: sessions_total
+        type: counter
+`
+
+var mockQueryStdout = `
+NETAPPUSER,PFNETAPP,59.94,3,50.0,2020-03-22 05:09:43.000000,10
+PROJECT,PTGPFS,1.5,1000,"99,5",,
+`
+
+func loadQueryTarget(t *testing.T) *config.Target {
+	path := filepath.Join(t.TempDir(), "tsm_exporter.yaml")
+	if err := os.WriteFile(path, []byte(queryConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sc := &config.SafeConfig{}
+	if err := sc.ReloadConfig(path); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	return sc.C.Targets["tsm1.example.com"]
+}
+
+func TestQueryCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = mockQueryStdout
+	defer func() { execCommand = exec.CommandContext }()
+	target := loadQueryTarget(t)
+	expected := `
+	# HELP tsm_exporter_collect_error Indicates if error has occurred during collection
+	# TYPE tsm_exporter_collect_error gauge
+	tsm_exporter_collect_error{collector="node_occupancy"} 0
+	# HELP tsm_exporter_collect_timeout Indicates the collector timed out
+	# TYPE tsm_exporter_collect_timeout gauge
+	tsm_exporter_collect_timeout{collector="node_occupancy"} 0
+	# HELP tsm_query_node_occupancy_files Value of column files from query node_occupancy
+	# TYPE tsm_query_node_occupancy_files gauge
+	tsm_query_node_occupancy_files{node="NETAPPUSER",stgpool="PFNETAPP"} 3
+	tsm_query_node_occupancy_files{node="PROJECT",stgpool="PTGPFS"} 1000
+	# HELP tsm_query_node_occupancy_last_backup_timestamp_seconds Value of column last_backup from query node_occupancy
+	# TYPE tsm_query_node_occupancy_last_backup_timestamp_seconds gauge
+	tsm_query_node_occupancy_last_backup_timestamp_seconds{node="NETAPPUSER",stgpool="PFNETAPP"} 1584853783
+	# HELP tsm_query_node_occupancy_logical_bytes Logical space occupied
+	# TYPE tsm_query_node_occupancy_logical_bytes gauge
+	tsm_query_node_occupancy_logical_bytes{node="NETAPPUSER",stgpool="PFNETAPP"} 62851645.44
+	tsm_query_node_occupancy_logical_bytes{node="PROJECT",stgpool="PTGPFS"} 1572864
+	# HELP tsm_query_node_occupancy_sessions_total Value of column sessions from query node_occupancy
+	# TYPE tsm_query_node_occupancy_sessions_total counter
+	tsm_query_node_occupancy_sessions_total{node="NETAPPUSER",stgpool="PFNETAPP"} 10
+	# HELP tsm_query_node_occupancy_utilized_ratio Value of column pct_utilized from query node_occupancy
+	# TYPE tsm_query_node_occupancy_utilized_ratio gauge
+	tsm_query_node_occupancy_utilized_ratio{node="NETAPPUSER",stgpool="PFNETAPP"} 0.5
+	tsm_query_node_occupancy_utilized_ratio{node="PROJECT",stgpool="PTGPFS"} 0.995
+	`
+	collector := NewQueryExporter(context.Background(), target.Queries[0], target, log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 11 {
+		t.Errorf("Unexpected collection count %d, expected 11", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"tsm_query_node_occupancy_files", "tsm_query_node_occupancy_last_backup_timestamp_seconds",
+		"tsm_query_node_occupancy_logical_bytes", "tsm_query_node_occupancy_sessions_total",
+		"tsm_query_node_occupancy_utilized_ratio",
+		"tsm_exporter_collect_error", "tsm_exporter_collect_timeout"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestQueryCollectorError(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 1
+	mockedStdout = ""
+	defer func() { execCommand = exec.CommandContext }()
+	target := loadQueryTarget(t)
+	expected := `
+	# HELP tsm_exporter_collect_error Indicates if error has occurred during collection
+	# TYPE tsm_exporter_collect_error gauge
+	tsm_exporter_collect_error{collector="node_occupancy"} 1
+	`
+	collector := NewQueryExporter(context.Background(), target.Queries[0], target, log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 3 {
+		t.Errorf("Unexpected collection count %d, expected 3", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "tsm_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestQueryCollectorParseError(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "NETAPPUSER,PFNETAPP,foo,3,50.0,,10\n"
+	defer func() { execCommand = exec.CommandContext }()
+	target := loadQueryTarget(t)
+	expected := `
+	# HELP tsm_exporter_collect_error Indicates if error has occurred during collection
+	# TYPE tsm_exporter_collect_error gauge
+	tsm_exporter_collect_error{collector="node_occupancy"} 1
+	`
+	collector := NewQueryExporter(context.Background(), target.Queries[0], target, log.NewNopLogger())
+	if err := testutil.GatherAndCompare(setupGatherer(collector), strings.NewReader(expected), "tsm_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestNewCollectorQueries(t *testing.T) {
+	target := loadQueryTarget(t)
+	target.Collectors = []string{"volumes"}
+	collectors := NewCollector(context.Background(), target, log.NewNopLogger()).Collectors
+	if _, ok := collectors["node_occupancy"]; !ok {
+		t.Errorf("Query collector not enabled")
+	}
+	if len(collectors) != 2 {
+		t.Errorf("Unexpected collectors: %v", collectors)
+	}
+}
+
+func TestQueryCollectorInvalidRow(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = mockQueryStdout + "Ignored\n"
+	defer func() { execCommand = exec.CommandContext }()
+	target := loadQueryTarget(t)
+	expected := `
+	# HELP tsm_exporter_collect_error Indicates if error has occurred during collection
+	# TYPE tsm_exporter_collect_error gauge
+	tsm_exporter_collect_error{collector="node_occupancy"} 1
+	# HELP tsm_query_node_occupancy_files Value of column files from query node_occupancy
+	# TYPE tsm_query_node_occupancy_files gauge
+	tsm_query_node_occupancy_files{node="NETAPPUSER",stgpool="PFNETAPP"} 3
+	tsm_query_node_occupancy_files{node="PROJECT",stgpool="PTGPFS"} 1000
+	`
+	collector := NewQueryExporter(context.Background(), target.Queries[0], target, log.NewNopLogger())
+	if err := testutil.GatherAndCompare(setupGatherer(collector), strings.NewReader(expected),
+		"tsm_exporter_collect_error", "tsm_query_node_occupancy_files"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestQueryCollectorDuplicateRow(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = mockQueryStdout + "NETAPPUSER,PFNETAPP,1.0,7,50.0,2020-03-22 05:09:43.000000,10\n"
+	defer func() { execCommand = exec.CommandContext }()
+	target := loadQueryTarget(t)
+	expected := `
+	# HELP tsm_exporter_collect_error Indicates if error has occurred during collection
+	# TYPE tsm_exporter_collect_error gauge
+	tsm_exporter_collect_error{collector="node_occupancy"} 1
+	# HELP tsm_query_node_occupancy_files Value of column files from query node_occupancy
+	# TYPE tsm_query_node_occupancy_files gauge
+	tsm_query_node_occupancy_files{node="NETAPPUSER",stgpool="PFNETAPP"} 3
+	tsm_query_node_occupancy_files{node="PROJECT",stgpool="PTGPFS"} 1000
+	`
+	collector := NewQueryExporter(context.Background(), target.Queries[0], target, log.NewNopLogger())
+	if err := testutil.GatherAndCompare(setupGatherer(collector), strings.NewReader(expected),
+		"tsm_exporter_collect_error", "tsm_query_node_occupancy_files"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestRegisteredCollectors(t *testing.T) {
+	for name := range collectorState {
+		if !config.IsCollector(name) {
+			t.Errorf("Collector %s is not registered with the config package", name)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/treydock/tsm_exporter/config"
+	yaml "gopkg.in/yaml.v3"
+)
+
+var (
+	recordDir       = kingpin.Flag("dsmadmc.record-dir", "Directory to save each query and its output, one directory per target").Default("").String()
+	replayDir       = kingpin.Flag("dsmadmc.replay-dir", "Directory of recordings made with --dsmadmc.record-dir to serve in place of querying TSM").Default("").String()
+	recordTimestamp = regexp.MustCompile(`\d{4}-\d{2}-\d{2}( \d{2}:\d{2}:\d{2}(\.\d+)?)?`)
+	unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+)
+
+type recordingKey struct{}
+
+// recording is a query and its result, the format is compatible with dsmadmc-sim fixtures
+type recording struct {
+	Query    string        `yaml:"query"`
+	Stdout   string        `yaml:"stdout"`
+	Stderr   string        `yaml:"stderr"`
+	ExitCode int           `yaml:"exit_code"`
+	Duration time.Duration `yaml:"duration"`
+	Error    string        `yaml:"error,omitempty"`
+	Timeout  bool          `yaml:"timeout,omitempty"`
+	raw      bool
+}
+
+// recordExec saves the raw output of dsmadmc to the recording in the context, if any
+func recordExec(ctx context.Context, stdout string, stderr string, err error) {
+	rec, ok := ctx.Value(recordingKey{}).(*recording)
+	if !ok {
+		return
+	}
+	rec.Stdout = stdout
+	rec.Stderr = stderr
+	rec.ExitCode = exitCode(err)
+	rec.raw = true
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+func recordingDir(dir string, target *config.Target) string {
+	return filepath.Join(dir, unsafeFileChars.ReplaceAllString(target.Name, "_"))
+}
+
+func recordingFile(query string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(query)))[:16] + ".yaml"
+}
+
+// recordQuery runs the query with the target's backend and saves the result
+func recordQuery(target *config.Target, query string, ctx context.Context, logger log.Logger) (string, error) {
+	rec := &recording{Query: query}
+	start := time.Now()
+	out, err := getBackend(target).Query(context.WithValue(ctx, recordingKey{}, rec), target, query, logger)
+	rec.Duration = time.Since(start).Round(time.Millisecond)
+	if !rec.raw {
+		rec.Stdout = out
+		rec.ExitCode = exitCode(err)
+	}
+	if err == context.DeadlineExceeded {
+		rec.Timeout = true
+	} else if err != nil {
+		rec.Error = err.Error()
+	}
+	if saveErr := saveRecording(recordingDir(*recordDir, target), rec); saveErr != nil {
+		level.Error(logger).Log("msg", "Error saving recording", "dir", *recordDir, "err", saveErr)
+	}
+	return out, err
+}
+
+func saveRecording(dir string, rec *recording) error {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".recording")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, recordingFile(rec.Query)))
+}
+
+func loadRecording(path string) (*recording, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rec := &recording{}
+	if err := yaml.Unmarshal(data, rec); err != nil {
+		return nil, fmt.Errorf("Error parsing recording %s: %s", path, err)
+	}
+	return rec, nil
+}
+
+// findRecording returns the recording of the query, falling back to a recording
+// of the same query made with different dates such as the events and summary queries
+func findRecording(dir string, query string) (*recording, error) {
+	rec, err := loadRecording(filepath.Join(dir, recordingFile(query)))
+	if err == nil {
+		return rec, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	normalized := recordTimestamp.ReplaceAllString(query, "")
+	for _, file := range files {
+		rec, err := loadRecording(file)
+		if err != nil {
+			return nil, err
+		}
+		if recordTimestamp.ReplaceAllString(rec.Query, "") == normalized {
+			return rec, nil
+		}
+	}
+	return nil, fmt.Errorf("No recording found for query %q in %s", query, dir)
+}
+
+// replayQuery returns the output of a recorded query the same way the query was originally handled
+func replayQuery(target *config.Target, query string, ctx context.Context, logger log.Logger) (string, error) {
+	dir := recordingDir(*replayDir, target)
+	level.Debug(logger).Log("msg", "dsmadmc replay", "dir", dir, "query", query)
+	rec, err := findRecording(dir, query)
+	if err != nil {
+		level.Error(logger).Log("msg", "Error replaying query", "err", err)
+		return "", err
+	}
+	if rec.Timeout {
+		level.Error(logger).Log("msg", "Timeout executing dsmadmc")
+		return "", context.DeadlineExceeded
+	}
+	if rec.ExitCode != 0 || rec.Error != "" {
+		if strings.Contains(rec.Stdout, "No match found using this criteria") {
+			return "", nil
+		}
+		message := rec.Error
+		if message == "" {
+			message = fmt.Sprintf("exit status %d", rec.ExitCode)
+		}
+		level.Error(logger).Log("msg", "Error executing dsmadmc", "err", rec.Stderr, "out", rec.Stdout)
+		return "", errors.New(message)
+	}
+	level.Debug(logger).Log("msg", "query output", "out", rec.Stdout)
+	return rec.Stdout, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+func setRecordFlags(t *testing.T, args ...string) {
+	if _, err := kingpin.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = kingpin.CommandLine.Parse([]string{})
+	})
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	target := &config.Target{Name: "test", Servername: "tsm1", Id: "admin", Password: "secret"}
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "SP03,foo\n"
+	defer func() { execCommand = exec.CommandContext }()
+	setRecordFlags(t, "--dsmadmc.record-dir="+dir)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := dsmadmcQuery(target, "QUERY STATUS", ctx, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	rec, err := loadRecording(filepath.Join(dir, "test", recordingFile("QUERY STATUS")))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if rec.Query != "QUERY STATUS" || rec.Stdout != mockedStdout || rec.ExitCode != 0 {
+		t.Errorf("Unexpected recording: %+v", rec)
+	}
+
+	execCommand = exec.CommandContext
+	mockedStdout = ""
+	setRecordFlags(t, "--dsmadmc.replay-dir="+dir)
+	replayed, err := dsmadmcQuery(target, "QUERY STATUS", ctx, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if replayed != out {
+		t.Errorf("Unexpected out: %q", replayed)
+	}
+}
+
+func TestRecordReplayNoMatch(t *testing.T) {
+	dir := t.TempDir()
+	target := &config.Target{Name: "test"}
+	execCommand = fakeExecCommand
+	mockedExitStatus = 11
+	mockedStdout = "ANR2034E SELECT: No match found using this criteria.\nANS8001I Return code 11.\n"
+	defer func() { execCommand = exec.CommandContext }()
+	setRecordFlags(t, "--dsmadmc.record-dir="+dir)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := dsmadmcQuery(target, "SELECT * FROM drives", ctx, log.NewNopLogger()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	rec, err := loadRecording(filepath.Join(dir, "test", recordingFile("SELECT * FROM drives")))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if rec.ExitCode != 11 || rec.Stdout != mockedStdout {
+		t.Errorf("Unexpected recording: %+v", rec)
+	}
+	setRecordFlags(t, "--dsmadmc.replay-dir="+dir)
+	out, err := dsmadmcQuery(target, "SELECT * FROM drives", ctx, log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if out != "" {
+		t.Errorf("Unexpected out: %q", out)
+	}
+}
+
+func TestRecordReplayError(t *testing.T) {
+	dir := t.TempDir()
+	target := &config.Target{Name: "test"}
+	execCommand = fakeExecCommand
+	mockedExitStatus = 3
+	mockedStdout = "ANR2904E Unexpected SQL key word token - 'FROM'.\n"
+	defer func() { execCommand = exec.CommandContext }()
+	setRecordFlags(t, "--dsmadmc.record-dir="+dir)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := dsmadmcQuery(target, "SELECT * FROM db", ctx, log.NewNopLogger()); err == nil {
+		t.Fatalf("Expected error")
+	}
+	setRecordFlags(t, "--dsmadmc.replay-dir="+dir)
+	_, err := dsmadmcQuery(target, "SELECT * FROM db", ctx, log.NewNopLogger())
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	if err.Error() != "exit status 3" {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestReplayTimeout(t *testing.T) {
+	dir := t.TempDir()
+	if err := saveRecording(filepath.Join(dir, "test"), &recording{Query: "QUERY STATUS", Timeout: true}); err != nil {
+		t.Fatal(err)
+	}
+	setRecordFlags(t, "--dsmadmc.replay-dir="+dir)
+	_, err := dsmadmcQuery(&config.Target{Name: "test"}, "QUERY STATUS", context.Background(), log.NewNopLogger())
+	if err != context.DeadlineExceeded {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestReplayDifferentDates(t *testing.T) {
+	dir := t.TempDir()
+	recorded := "SELECT schedule_name,status FROM events WHERE DATE(scheduled_start) BETWEEN '2020-03-21' AND '2020-03-22'"
+	if err := saveRecording(filepath.Join(dir, "test"), &recording{Query: recorded, Stdout: "FOO,Future\n"}); err != nil {
+		t.Fatal(err)
+	}
+	setRecordFlags(t, "--dsmadmc.replay-dir="+dir)
+	query := "SELECT schedule_name,status FROM events WHERE DATE(scheduled_start) BETWEEN '2023-01-01' AND '2023-01-02'"
+	out, err := dsmadmcQuery(&config.Target{Name: "test"}, query, context.Background(), log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if out != "FOO,Future\n" {
+		t.Errorf("Unexpected out: %q", out)
+	}
+}
+
+func TestReplayMissing(t *testing.T) {
+	setRecordFlags(t, "--dsmadmc.replay-dir="+t.TempDir())
+	_, err := dsmadmcQuery(&config.Target{Name: "test"}, "QUERY STATUS", context.Background(), log.NewNopLogger())
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	if !strings.Contains(err.Error(), "No recording found") {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
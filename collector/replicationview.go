@@ -50,6 +50,7 @@ type ReplicationViewCollector struct {
 	ReplicatedBytes           *prometheus.Desc
 	ReplicatedFiles           *prometheus.Desc
 	ReplicatedFilesIncomplete *prometheus.Desc
+	ctx                       context.Context
 	target                    *config.Target
 	logger                    log.Logger
 }
@@ -58,7 +59,7 @@ func init() {
 	registerCollector("replicationview", true, NewReplicationViewExporter)
 }
 
-func NewReplicationViewExporter(target *config.Target, logger log.Logger) Collector {
+func NewReplicationViewExporter(ctx context.Context, target *config.Target, logger log.Logger) Collector {
 	labels := []string{"nodename", "fsname"}
 	return &ReplicationViewCollector{
 		StartTime: prometheus.NewDesc(prometheus.BuildFQName(namespace, "replication", "start_timestamp_seconds"),
@@ -75,6 +76,7 @@ func NewReplicationViewExporter(target *config.Target, logger log.Logger) Collec
 			"Number of files replicated", labels, nil),
 		ReplicatedFilesIncomplete: prometheus.NewDesc(prometheus.BuildFQName(namespace, "replication", "incomplete_replicated_files"),
 			"Number of files replicated for incomplete", labels, nil),
+		ctx:    ctx,
 		target: target,
 		logger: logger,
 	}
@@ -122,7 +124,7 @@ func (c *ReplicationViewCollector) Collect(ch chan<- prometheus.Metric) {
 }
 
 func (c *ReplicationViewCollector) collect() (map[string]ReplicationViewMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*replicationviewTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(c.ctx, collectorTimeout(c.target, "replicationview", *replicationviewTimeout))
 	defer cancel()
 	out, err := DsmadmcReplicationViewExec(c.target, ctx, c.logger)
 	if err != nil {
@@ -134,8 +136,8 @@ func (c *ReplicationViewCollector) collect() (map[string]ReplicationViewMetric,
 
 func buildReplicationViewQuery(target *config.Target) string {
 	query := "SELECT NODE_NAME, FSNAME, START_TIME, END_TIME, TOTFILES_REPLICATED, TOTBYTES_REPLICATED, COMP_STATE FROM replicationview"
-	if target.ReplicationNodeNames != nil {
-		query = query + fmt.Sprintf(" WHERE NODE_NAME IN (%s)", buildInFilter(target.ReplicationNodeNames))
+	if nodeNames := target.Options("replicationview").ReplicationNodeNames; nodeNames != nil {
+		query = query + fmt.Sprintf(" WHERE NODE_NAME IN (%s)", buildInFilter(nodeNames))
 	}
 	query = query + " ORDER BY END_TIME DESC"
 	return query
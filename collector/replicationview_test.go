@@ -130,7 +130,7 @@ func TestReplicationViewCollector(t *testing.T) {
 	`
 	zone := "America/New_York"
 	timezone = &zone
-	collector := NewReplicationViewExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewReplicationViewExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -162,7 +162,7 @@ func TestReplicationViewCollectorError(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="replicationview"} 0
 	`
-	collector := NewReplicationViewExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewReplicationViewExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -194,7 +194,7 @@ func TestReplicationViewCollectorTimeout(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="replicationview"} 1
 	`
-	collector := NewReplicationViewExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewReplicationViewExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -0,0 +1,229 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+const (
+	restCommandPath = "/oc/api/cli/issueCommand"
+	restAPIVersion  = "1.0"
+)
+
+// restBackend issues commands through the Operations Center REST API
+type restBackend struct {
+	sync.Mutex
+	clients map[string]restClient
+}
+
+type restClient struct {
+	target *config.Target
+	client *http.Client
+}
+
+func newRestBackend() *restBackend {
+	return &restBackend{clients: make(map[string]restClient)}
+}
+
+// client returns the HTTP client of a target, module copies of a target share the client of their base target
+func (b *restBackend) client(target *config.Target) (*http.Client, error) {
+	target = target.Base()
+	b.Lock()
+	defer b.Unlock()
+	if c, ok := b.clients[target.Name]; ok && c.target == target {
+		return c.client, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: target.Rest.InsecureSkipVerify} //nolint:gosec
+	if target.Rest.CAFile != "" {
+		ca, err := os.ReadFile(target.Rest.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("Unable to parse CA certificates from %s", target.Rest.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client := &http.Client{Transport: transport}
+	b.clients[target.Name] = restClient{target: target, client: client}
+	return client, nil
+}
+
+func (b *restBackend) forget(name string) {
+	b.Lock()
+	defer b.Unlock()
+	if c, ok := b.clients[name]; ok {
+		c.client.CloseIdleConnections()
+		delete(b.clients, name)
+	}
+}
+
+func (b *restBackend) Query(ctx context.Context, target *config.Target, query string, logger log.Logger) (string, error) {
+	client, err := b.client(target)
+	if err != nil {
+		level.Error(logger).Log("msg", "Error creating REST client", "err", err)
+		return "", err
+	}
+	command := query
+	if target.Rest.Server != "" {
+		command = fmt.Sprintf("%s: %s", target.Rest.Server, query)
+	}
+	url := strings.TrimSuffix(target.Rest.URL, "/") + restCommandPath
+	level.Debug(logger).Log("msg", "REST query", "url", url, "query", command)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(command))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(target.Id, target.Password)
+	req.Header.Set("OC-API-Version", restAPIVersion)
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			level.Error(logger).Log("msg", "Timeout executing REST query")
+			return "", ctx.Err()
+		}
+		level.Error(logger).Log("msg", "Error executing REST query", "err", err)
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			level.Error(logger).Log("msg", "Timeout executing REST query")
+			return "", ctx.Err()
+		}
+		return "", err
+	}
+	if strings.Contains(string(body), "No match found using this criteria") {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		level.Error(logger).Log("msg", "Error executing REST query", "status", resp.StatusCode, "out", string(body))
+		return "", fmt.Errorf("REST query returned status %d", resp.StatusCode)
+	}
+	out, err := restItemsToCSV(body)
+	if err != nil {
+		level.Error(logger).Log("msg", "Error parsing REST response", "err", err, "out", string(body))
+		return "", err
+	}
+	level.Debug(logger).Log("msg", "query output", "out", out)
+	return out, nil
+}
+
+// restItemsToCSV converts the ITEMS of a REST response to CSV,
+// keeping each item's values in the order the columns were returned
+func restItemsToCSV(body []byte) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := expectDelim(decoder, '{'); err != nil {
+		return "", err
+	}
+	var records [][]string
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		if !strings.EqualFold(fmt.Sprintf("%v", key), "ITEMS") {
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if err := expectDelim(decoder, '['); err != nil {
+			return "", err
+		}
+		for decoder.More() {
+			record, err := restItem(decoder)
+			if err != nil {
+				return "", err
+			}
+			records = append(records, record)
+		}
+		if err := expectDelim(decoder, ']'); err != nil {
+			return "", err
+		}
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(records); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func restItem(decoder *json.Decoder) ([]string, error) {
+	var record []string
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
+	for decoder.More() {
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		value, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch v := value.(type) {
+		case nil:
+			record = append(record, "")
+		case string:
+			record = append(record, v)
+		case json.Number:
+			record = append(record, v.String())
+		case bool:
+			record = append(record, strings.ToUpper(fmt.Sprintf("%v", v)))
+		default:
+			return nil, fmt.Errorf("Unexpected value %v in REST item", v)
+		}
+	}
+	if err := expectDelim(decoder, '}'); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := token.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("Unexpected token %v in REST response, expected %v", token, delim)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+// restServer serves recorded REST responses from testdata/rest keyed by the start of the command
+func restServer(t *testing.T) *httptest.Server {
+	responses := map[string]string{
+		"TSM1: SELECT BUFF_HIT_RATIO": "testdata/rest/db.json",
+		"TSM1: SELECT nomatch":        "testdata/rest/nomatch.json",
+		"TSM1: SELECT volumes":        "testdata/rest/volumes.json",
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != restCommandPath || r.Header.Get("OC-API-Version") != restAPIVersion {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		command := string(body)
+		if command == "TSM1: SELECT slow" {
+			time.Sleep(500 * time.Millisecond)
+		}
+		for prefix, file := range responses {
+			if strings.HasPrefix(command, prefix) {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					t.Errorf("Unable to read %s: %s", file, err)
+				}
+				_, _ = w.Write(data)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"MESSAGES":[{"MSGID":"ANR2000E"}]}`))
+	}))
+}
+
+func restTarget(url string) *config.Target {
+	return &config.Target{
+		Name:     "rest",
+		Id:       "admin",
+		Password: "secret",
+		Backend:  config.BackendRest,
+		Rest:     &config.RestConfig{URL: url, Server: "TSM1"},
+	}
+}
+
+func TestRestQuery(t *testing.T) {
+	server := restServer(t)
+	defer server.Close()
+	target := restTarget(server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := dsmadmcQuery(target, "SELECT volumes", ctx, log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	expected := "E00001L6,\"LTO, \"\"6\"\"\",\nE00002L6,LTO,READONLY\n"
+	if out != expected {
+		t.Errorf("Unexpected out:\nExpected: %q\nGot: %q", expected, out)
+	}
+	out, err = dsmadmcQuery(target, "SELECT nomatch", ctx, log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != "" {
+		t.Errorf("Unexpected out: %q", out)
+	}
+	if _, err = dsmadmcQuery(target, "SELECT error", ctx, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+	target.Password = "wrong"
+	if _, err = dsmadmcQuery(target, "SELECT volumes", ctx, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+}
+
+func TestRestQueryTimeout(t *testing.T) {
+	server := restServer(t)
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := dsmadmcQuery(restTarget(server.URL), "SELECT slow", ctx, log.NewNopLogger())
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected timeout, got %v", err)
+	}
+}
+
+func TestRestDBCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	server := restServer(t)
+	defer server.Close()
+	DsmadmcDBExec = dsmadmcDB
+	expected := `
+    # HELP tsm_db_pages_total DB total pages
+    # TYPE tsm_db_pages_total gauge
+    tsm_db_pages_total{dbname="TSMDB1"} 28836868
+    # HELP tsm_exporter_collect_error Indicates if error has occurred during collection
+    # TYPE tsm_exporter_collect_error gauge
+    tsm_exporter_collect_error{collector="db"} 0
+	`
+	collector := NewDBExporter(context.Background(), restTarget(server.URL), log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"tsm_db_pages_total", "tsm_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestRestItemsToCSVErrors(t *testing.T) {
+	tests := []string{
+		`[]`,
+		`{"ITEMS":{}}`,
+		`{"ITEMS":[{"A":{}}]}`,
+		`{"ITEMS":[`,
+	}
+	for i, test := range tests {
+		if _, err := restItemsToCSV([]byte(test)); err == nil {
+			t.Errorf("Expected error in case %d", i)
+		}
+	}
+}
+
+func TestRestClientModuleTarget(t *testing.T) {
+	b := newRestBackend()
+	target := restTarget("https://oc.example.com")
+	module := target.WithModule("nightly", &config.Module{Collectors: []string{"occupancy"}})
+	client, err := b.client(target)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	for _, queryTarget := range []*config.Target{module, target, module} {
+		if c, _ := b.client(queryTarget); c != client {
+			t.Errorf("HTTP client was not reused")
+		}
+	}
+}
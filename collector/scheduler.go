@@ -0,0 +1,268 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+var (
+	collectorLastSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "collector_last_success_timestamp_seconds"),
+		"Unix timestamp of the last successful background collection",
+		[]string{"collector"}, nil)
+	collectorCacheAge = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "collector_cache_age_seconds"),
+		"Age of the cached results served for a collector",
+		[]string{"collector"}, nil)
+)
+
+// Scheduler refreshes collectors in the background based on each target's refresh schedules
+type Scheduler struct {
+	sync.Mutex
+	entries map[string]*scheduleEntry
+	running sync.WaitGroup
+	logger  log.Logger
+}
+
+type scheduleEntry struct {
+	name      string
+	collector Collector
+	schedule  *config.RefreshSchedule
+	maxStale  time.Duration
+	cache     *collectorCache
+	stop      chan struct{}
+	cancel    context.CancelFunc
+	logger    log.Logger
+}
+
+// collectorCache holds the results of the last background collection, it is kept across config reloads
+type collectorCache struct {
+	sync.RWMutex
+	run         sync.Mutex
+	metrics     []prometheus.Metric
+	good        []prometheus.Metric
+	lastRun     time.Time
+	lastSuccess time.Time
+	updated     time.Time
+}
+
+func NewScheduler(logger log.Logger) *Scheduler {
+	return &Scheduler{
+		entries: make(map[string]*scheduleEntry),
+		logger:  logger,
+	}
+}
+
+func scheduleKey(target string, collector string) string {
+	return target + "/" + collector
+}
+
+// Update replaces the running schedules with the schedules of the given targets
+func (s *Scheduler) Update(targets map[string]*config.Target) {
+	s.Lock()
+	defer s.Unlock()
+	entries := make(map[string]*scheduleEntry)
+	for name, target := range targets {
+		if len(target.RefreshSchedules) == 0 {
+			continue
+		}
+		for key, schedule := range target.RefreshSchedules {
+			// Each entry has its own context so its refresh can be canceled when the entry is dropped
+			ctx, cancel := context.WithCancel(context.Background())
+			collector, ok := NewCollector(ctx, target, s.logger).Collectors[key]
+			if !ok {
+				cancel()
+				level.Warn(s.logger).Log("msg", "Refresh schedule defined for collector that is not enabled", "target", name, "collector", key)
+				continue
+			}
+			// The cached results are served with the last successful results instead of collecting them twice
+			var maxStale time.Duration
+			if fallback, ok := collector.(*fallbackCollector); ok {
+				collector = fallback.collector
+				maxStale = fallback.maxStale
+			}
+			entry := &scheduleEntry{
+				name:      key,
+				collector: collector,
+				schedule:  schedule,
+				maxStale:  maxStale,
+				cache:     &collectorCache{},
+				stop:      make(chan struct{}),
+				cancel:    cancel,
+				logger:    log.With(s.logger, "collector", key, "target", name),
+			}
+			if previous, ok := s.entries[scheduleKey(name, key)]; ok {
+				entry.cache = previous.cache
+			}
+			entries[scheduleKey(name, key)] = entry
+		}
+	}
+	for key, entry := range s.entries {
+		close(entry.stop)
+		// A refresh in progress of a kept entry finishes and fills the cache shared with the new entry
+		if _, ok := entries[key]; !ok {
+			entry.cancel()
+		}
+	}
+	for _, entry := range entries {
+		level.Debug(entry.logger).Log("msg", "Scheduling background collection", "refresh", entry.schedule.Spec)
+		s.running.Add(1)
+		go func(entry *scheduleEntry) {
+			defer s.running.Done()
+			entry.loop()
+		}(entry)
+	}
+	s.entries = entries
+}
+
+// Stop stops all background collection, cancels refreshes in progress and waits for them to return
+func (s *Scheduler) Stop() {
+	s.Update(nil)
+	s.running.Wait()
+}
+
+// Cached replaces the collectors that are refreshed in the background with their cached results
+func (s *Scheduler) Cached(target *config.Target, tsmCollector *TSMCollector) {
+	s.Lock()
+	defer s.Unlock()
+	for key := range tsmCollector.Collectors {
+		if entry, ok := s.entries[scheduleKey(target.Name, key)]; ok {
+			tsmCollector.Collectors[key] = &cachedCollector{name: key, cache: entry.cache, maxStale: entry.maxStale}
+		}
+	}
+}
+
+func (e *scheduleEntry) loop() {
+	defer e.cancel()
+	for {
+		next := time.Now()
+		e.cache.RLock()
+		if !e.cache.lastRun.IsZero() {
+			next = e.schedule.Next(e.cache.lastRun)
+		}
+		e.cache.RUnlock()
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-e.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		e.refresh()
+	}
+}
+
+func (e *scheduleEntry) refresh() {
+	e.cache.run.Lock()
+	defer e.cache.run.Unlock()
+	select {
+	case <-e.stop:
+		return
+	default:
+	}
+	e.cache.RLock()
+	lastRun := e.cache.lastRun
+	e.cache.RUnlock()
+	// A collection from before a config reload may have finished while waiting
+	if !lastRun.IsZero() && time.Now().Before(e.schedule.Next(lastRun)) {
+		return
+	}
+	start := time.Now()
+	level.Debug(e.logger).Log("msg", "Running background collection")
+	metrics := gatherCollector(e.collector)
+	success := collectSucceeded(metrics)
+	e.cache.Lock()
+	defer e.cache.Unlock()
+	e.cache.lastRun = start
+	e.cache.metrics = metrics
+	e.cache.updated = time.Now()
+	if success {
+		e.cache.lastSuccess = e.cache.updated
+		e.cache.good = dataMetrics(metrics)
+	}
+}
+
+func gatherCollector(collector Collector) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(ch)
+		close(ch)
+	}()
+	var metrics []prometheus.Metric
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// collectSucceeded checks the collect_error and collect_timeout metrics of a collection
+func collectSucceeded(metrics []prometheus.Metric) bool {
+	for _, metric := range metrics {
+		if metric.Desc() != collectError && metric.Desc() != collecTimeout {
+			continue
+		}
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			return false
+		}
+		if m.GetGauge().GetValue() != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// cachedCollector serves the results of a background collection
+type cachedCollector struct {
+	name     string
+	cache    *collectorCache
+	maxStale time.Duration
+}
+
+// Describe sends no descriptors as the cached metrics are only known after collection
+func (c *cachedCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+func (c *cachedCollector) Collect(ch chan<- prometheus.Metric) {
+	c.cache.RLock()
+	defer c.cache.RUnlock()
+	now := time.Now()
+	updated := c.cache.updated
+	if c.maxStale > 0 {
+		if emitWithFallback(ch, c.name, c.cache.metrics, c.cache.good, c.cache.lastSuccess, now, c.maxStale) {
+			updated = c.cache.lastSuccess
+		}
+	} else {
+		for _, metric := range c.cache.metrics {
+			ch <- metric
+		}
+	}
+	var lastSuccess float64
+	if !c.cache.lastSuccess.IsZero() {
+		lastSuccess = float64(c.cache.lastSuccess.Unix())
+	}
+	ch <- prometheus.MustNewConstMetric(collectorLastSuccess, prometheus.GaugeValue, lastSuccess, c.name)
+	if !updated.IsZero() {
+		ch <- prometheus.MustNewConstMetric(collectorCacheAge, prometheus.GaugeValue, now.Sub(updated).Seconds(), c.name)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+func loadScheduleTargets(t *testing.T, refresh string) map[string]*config.Target {
+	path := filepath.Join(t.TempDir(), "tsm_exporter.yaml")
+	data := fmt.Sprintf(`
+refresh:
+  log: %s
+targets:
+  tsm1.example.com:
+    id: somwell
+    password: secret
+    collectors:
+      - log
+      - status
+`, refresh)
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sc := &config.SafeConfig{}
+	if err := sc.ReloadConfig(path); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	return sc.C.Targets
+}
+
+func mockScheduledLog(t *testing.T, err error) *int32 {
+	var calls int32
+	DsmadmcLogExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		return mockedLogStdout, err
+	}
+	t.Cleanup(func() { DsmadmcLogExec = dsmadmcLog })
+	return &calls
+}
+
+func waitForRefresh(t *testing.T, s *Scheduler, key string) {
+	for i := 0; i < 100; i++ {
+		s.Lock()
+		entry := s.entries[key]
+		s.Unlock()
+		entry.cache.RLock()
+		updated := entry.cache.updated
+		entry.cache.RUnlock()
+		if !updated.IsZero() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timeout waiting for background collection")
+}
+
+func TestSchedulerCached(t *testing.T) {
+	calls := mockScheduledLog(t, nil)
+	targets := loadScheduleTargets(t, "1h")
+	target := targets["tsm1.example.com"]
+	s := NewScheduler(log.NewNopLogger())
+	defer s.Stop()
+	s.Update(targets)
+	waitForRefresh(t, s, "tsm1.example.com/log")
+
+	tsmCollector := NewCollector(context.Background(), target, log.NewNopLogger())
+	s.Cached(target, tsmCollector)
+	if _, ok := tsmCollector.Collectors["log"].(*cachedCollector); !ok {
+		t.Errorf("log collector is not cached")
+	}
+	if _, ok := tsmCollector.Collectors["status"].(*StatusCollector); !ok {
+		t.Errorf("status collector should not be cached")
+	}
+	gatherers := setupGatherer(tsmCollector.Collectors["log"])
+	expected := `
+	# HELP tsm_active_log_total_bytes Active log total space in bytes
+	# TYPE tsm_active_log_total_bytes gauge
+	tsm_active_log_total_bytes 34359738368
+	# HELP tsm_exporter_collect_error Indicates if error has occurred during collection
+	# TYPE tsm_exporter_collect_error gauge
+	tsm_exporter_collect_error{collector="log"} 0
+	`
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"tsm_active_log_total_bytes", "tsm_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	if val, err := testutil.GatherAndCount(gatherers, "tsm_exporter_collector_last_success_timestamp_seconds", "tsm_exporter_collector_cache_age_seconds"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 2 {
+		t.Errorf("Unexpected collection count %d, expected 2", val)
+	}
+	// Scrapes are served from the cache
+	_, _ = gatherers.Gather()
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("Unexpected number of queries %d", n)
+	}
+}
+
+func TestSchedulerFailure(t *testing.T) {
+	_ = mockScheduledLog(t, fmt.Errorf("error"))
+	targets := loadScheduleTargets(t, "1h")
+	s := NewScheduler(log.NewNopLogger())
+	defer s.Stop()
+	s.Update(targets)
+	waitForRefresh(t, s, "tsm1.example.com/log")
+	tsmCollector := NewCollector(context.Background(), targets["tsm1.example.com"], log.NewNopLogger())
+	s.Cached(targets["tsm1.example.com"], tsmCollector)
+	expected := `
+	# HELP tsm_exporter_collect_error Indicates if error has occurred during collection
+	# TYPE tsm_exporter_collect_error gauge
+	tsm_exporter_collect_error{collector="log"} 1
+	# HELP tsm_exporter_collector_last_success_timestamp_seconds Unix timestamp of the last successful background collection
+	# TYPE tsm_exporter_collector_last_success_timestamp_seconds gauge
+	tsm_exporter_collector_last_success_timestamp_seconds{collector="log"} 0
+	`
+	if err := testutil.GatherAndCompare(setupGatherer(tsmCollector.Collectors["log"]), strings.NewReader(expected),
+		"tsm_exporter_collect_error", "tsm_exporter_collector_last_success_timestamp_seconds"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestSchedulerInterval(t *testing.T) {
+	calls := mockScheduledLog(t, nil)
+	targets := loadScheduleTargets(t, "50ms")
+	s := NewScheduler(log.NewNopLogger())
+	s.Update(targets)
+	time.Sleep(275 * time.Millisecond)
+	s.Stop()
+	if n := atomic.LoadInt32(calls); n < 3 || n > 7 {
+		t.Errorf("Unexpected number of queries %d", n)
+	}
+}
+
+func TestSchedulerReloadKeepsCache(t *testing.T) {
+	calls := mockScheduledLog(t, nil)
+	s := NewScheduler(log.NewNopLogger())
+	defer s.Stop()
+	s.Update(loadScheduleTargets(t, "0 2 * * *"))
+	waitForRefresh(t, s, "tsm1.example.com/log")
+	targets := loadScheduleTargets(t, "0 2 * * *")
+	s.Update(targets)
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("Unexpected number of queries %d", n)
+	}
+	tsmCollector := NewCollector(context.Background(), targets["tsm1.example.com"], log.NewNopLogger())
+	s.Cached(targets["tsm1.example.com"], tsmCollector)
+	if val, err := testutil.GatherAndCount(setupGatherer(tsmCollector.Collectors["log"]), "tsm_active_log_total_bytes"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 1 {
+		t.Errorf("Unexpected collection count %d, expected 1", val)
+	}
+	s.Update(nil)
+	if len(s.entries) != 0 {
+		t.Errorf("Unexpected entries after removing schedules: %v", s.entries)
+	}
+}
+
+func TestSchedulerStopCancelsRefresh(t *testing.T) {
+	started := make(chan struct{})
+	DsmadmcLogExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	defer func() { DsmadmcLogExec = dsmadmcLog }()
+	s := NewScheduler(log.NewNopLogger())
+	s.Update(loadScheduleTargets(t, "1h"))
+	<-started
+	s.Lock()
+	entry := s.entries["tsm1.example.com/log"]
+	s.Unlock()
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Refresh in progress was not canceled by Stop")
+	}
+	if !entry.cache.run.TryLock() {
+		t.Errorf("Refresh was still running after Stop returned")
+	}
+}
+
+func TestCollectSucceeded(t *testing.T) {
+	ok := []prometheus.Metric{
+		prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, 0, "log"),
+		prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, 0, "log"),
+	}
+	if !collectSucceeded(ok) {
+		t.Errorf("Expected success")
+	}
+	timeout := []prometheus.Metric{
+		prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, 0, "log"),
+		prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, 1, "log"),
+	}
+	if collectSucceeded(timeout) {
+		t.Errorf("Expected failure")
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+// setupSim builds dsmadmc-sim as dsmadmc and puts it first in PATH
+func setupSim(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping dsmadmc-sim tests in short mode")
+	}
+	binDir := t.TempDir()
+	build := exec.Command("go", "build", "-o", filepath.Join(binDir, "dsmadmc"), "../cmd/dsmadmc-sim")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("Error building dsmadmc-sim: %s: %s", err, out)
+	}
+	fixtures, err := filepath.Abs("../cmd/dsmadmc-sim/fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("DSMADMC_SIM_FIXTURES", fixtures)
+	if _, err := kingpin.CommandLine.Parse([]string{"--path.dsm_log.dir=" + t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	execCommand = exec.CommandContext
+	DsmadmcStatusExec = dsmadmcStatus
+	DsmadmcDBExec = dsmadmcDB
+	DsmadmcLogExec = dsmadmcLog
+	DsmadmcDrivesExec = dsmadmcDrives
+	DsmadmcEventsCompletedExec = dsmadmcEventsCompleted
+	DsmadmcEventsNotCompletedExec = dsmadmcEventsNotCompleted
+	DsmadmcLibVolumesExec = dsmadmcLibVolumes
+	DsmadmcOccupancysExec = dsmadmcOccupancys
+	DsmadmcReplicationViewExec = dsmadmcReplicationView
+	DsmadmcStoragePoolExec = dsmadmcStoragePool
+	DsmadmcSummaryExec = dsmadmcSummary
+	DsmadmcVolumesExec = dsmadmcVolumes
+	DsmadmcVolumeUsagesExec = dsmadmcVolumeUsages
+	t.Cleanup(func() {
+		_, _ = kingpin.CommandLine.Parse([]string{})
+	})
+}
+
+func simGatherer(target *config.Target) prometheus.Gatherer {
+	registry := prometheus.NewRegistry()
+	for _, c := range NewCollector(context.Background(), target, log.NewNopLogger()).Collectors {
+		registry.MustRegister(c)
+	}
+	return registry
+}
+
+func simCollectErrors(names []string, value string) string {
+	expected := "# HELP tsm_exporter_collect_error Indicates if error has occurred during collection\n# TYPE tsm_exporter_collect_error gauge\n"
+	for _, name := range names {
+		expected += "tsm_exporter_collect_error{collector=\"" + name + "\"} " + value + "\n"
+	}
+	return expected
+}
+
+func TestSimAllCollectors(t *testing.T) {
+	setupSim(t)
+	target := &config.Target{Name: "test", Servername: "TSM1", Id: "admin", Password: "secret"}
+	var names []string
+	for name := range collectorState {
+		// status reports failures with tsm_status rather than collect_error
+		if name != "status" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	gatherer := simGatherer(target)
+	if err := testutil.GatherAndCompare(gatherer, strings.NewReader(simCollectErrors(names, "0")), "tsm_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	expected := `
+	# HELP tsm_active_log_total_bytes Active log total space in bytes
+	# TYPE tsm_active_log_total_bytes gauge
+	tsm_active_log_total_bytes 34359738368
+	# HELP tsm_status Status of TSM, 1=online 0=failure
+	# TYPE tsm_status gauge
+	tsm_status 1
+	`
+	if err := testutil.GatherAndCompare(gatherer, strings.NewReader(expected), "tsm_active_log_total_bytes", "tsm_status"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestSimError(t *testing.T) {
+	setupSim(t)
+	target := &config.Target{Name: "test", Servername: "SIMERROR", Id: "admin", Password: "secret", Collectors: []string{"db", "log"}}
+	if err := testutil.GatherAndCompare(simGatherer(target), strings.NewReader(simCollectErrors([]string{"db", "log"}, "1")), "tsm_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestSimNoMatch(t *testing.T) {
+	setupSim(t)
+	target := &config.Target{Name: "test", Servername: "SIMNOMATCH", Id: "admin", Password: "secret", Collectors: []string{"drives", "volumes"}}
+	if err := testutil.GatherAndCompare(simGatherer(target), strings.NewReader(simCollectErrors([]string{"drives", "volumes"}, "0")), "tsm_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestSimTimeout(t *testing.T) {
+	setupSim(t)
+	if _, err := kingpin.CommandLine.Parse([]string{"--path.dsm_log.dir=" + t.TempDir(), "--collector.log.timeout=1"}); err != nil {
+		t.Fatal(err)
+	}
+	target := &config.Target{Name: "test", Servername: "SIMSLOW", Id: "admin", Password: "secret", Collectors: []string{"log"}}
+	expected := `
+	# HELP tsm_exporter_collect_timeout Indicates the collector timed out
+	# TYPE tsm_exporter_collect_timeout gauge
+	tsm_exporter_collect_timeout{collector="log"} 1
+	`
+	if err := testutil.GatherAndCompare(simGatherer(target), strings.NewReader(expected), "tsm_exporter_collect_timeout"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/treydock/tsm_exporter/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var (
+	sshDialTimeout = 30 * time.Second
+)
+
+// sshBackend runs dsmadmc on a remote host that has the TSM client installed
+type sshBackend struct {
+	sync.Mutex
+	clients map[string]*sshClient
+}
+
+// sshClient is the connection of a target, ready is closed once the dial finished with either client or err set
+type sshClient struct {
+	target *config.Target
+	client *ssh.Client
+	err    error
+	ready  chan struct{}
+}
+
+func newSSHBackend() *sshBackend {
+	return &sshBackend{clients: make(map[string]*sshClient)}
+}
+
+// client returns the connection of a target, concurrent queries of the target share one dial.
+// The dial runs in the background so that waiting for it is canceled with ctx and does not block other targets.
+// Module copies of a target share the connection of their base target.
+func (b *sshBackend) client(ctx context.Context, target *config.Target) (*ssh.Client, error) {
+	target = target.Base()
+	b.Lock()
+	c, ok := b.clients[target.Name]
+	if ok && c.target != target {
+		delete(b.clients, target.Name)
+		go c.close()
+		ok = false
+	}
+	if !ok {
+		c = &sshClient{target: target, ready: make(chan struct{})}
+		b.clients[target.Name] = c
+		go b.dial(c)
+	}
+	b.Unlock()
+	select {
+	case <-c.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.client, nil
+}
+
+// dial connects to the SSH host of a target, a failed connection is removed so the next query dials again
+func (b *sshBackend) dial(c *sshClient) {
+	ctx, cancel := context.WithTimeout(context.Background(), sshDialTimeout)
+	defer cancel()
+	c.client, c.err = sshDial(ctx, c.target)
+	if c.err != nil {
+		b.Lock()
+		if b.clients[c.target.Name] == c {
+			delete(b.clients, c.target.Name)
+		}
+		b.Unlock()
+	}
+	close(c.ready)
+}
+
+// close closes the connection once its dial finished
+func (c *sshClient) close() {
+	<-c.ready
+	if c.client != nil {
+		c.client.Close()
+	}
+}
+
+func sshDial(ctx context.Context, target *config.Target) (*ssh.Client, error) {
+	key, err := os.ReadFile(target.SSH.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := knownhosts.New(target.SSH.KnownHostsFile)
+	if err != nil {
+		return nil, err
+	}
+	sshConfig := &ssh.ClientConfig{
+		User:            target.SSH.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+	}
+	addr := target.SSH.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, sshConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+func (b *sshBackend) forget(name string) {
+	b.Lock()
+	defer b.Unlock()
+	if c, ok := b.clients[name]; ok {
+		delete(b.clients, name)
+		go c.close()
+	}
+}
+
+// drop closes a client that is no longer usable so the next query reconnects
+func (b *sshBackend) drop(target *config.Target, client *ssh.Client) {
+	b.Lock()
+	defer b.Unlock()
+	if c, ok := b.clients[target.Name]; ok && c.client == client {
+		delete(b.clients, target.Name)
+	}
+	client.Close()
+}
+
+func (b *sshBackend) Query(ctx context.Context, target *config.Target, query string, logger log.Logger) (string, error) {
+	client, err := b.client(ctx, target)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			level.Error(logger).Log("msg", "Timeout connecting to SSH host", "host", target.SSH.Host)
+			return "", ctx.Err()
+		}
+		level.Error(logger).Log("msg", "Error connecting to SSH host", "host", target.SSH.Host, "err", err)
+		return "", err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		level.Error(logger).Log("msg", "Error creating SSH session", "host", target.SSH.Host, "err", err)
+		b.drop(target, client)
+		return "", err
+	}
+	defer session.Close()
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	// A credential prompt of a stored login cancels the query instead of waiting for the timeout
+	queryCtx, cancelQuery := context.WithCancel(ctx)
+	defer cancelQuery()
+	prompt := &promptWriter{w: &stdout, cancel: cancelQuery}
+	session.Stdout = &stdout
+	if target.Login == config.LoginStored {
+		session.Stdout = prompt
+	}
+	session.Stderr = &stderr
+	args := []string{dsmadmcPath(target)}
+	if env := dsmadmcEnv(target); env != nil {
+		args = append(append([]string{"env"}, env...), args...)
+	}
+	args = append(args, dsmadmcArgs(target)...)
+	args = append(args, query)
+	level.Debug(logger).Log("msg", "dsmadmc query over SSH", "host", target.SSH.Host, "query", query)
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(shellJoin(args))
+	}()
+	select {
+	case err = <-done:
+	case <-queryCtx.Done():
+		_ = session.Signal(ssh.SIGKILL)
+		session.Close()
+		<-done
+		if prompt.prompt != "" {
+			level.Error(logger).Log("msg", "dsmadmc prompted for credentials", "prompt", prompt.prompt, "out", stdout.String())
+			return "", fmt.Errorf("dsmadmc prompted for credentials (%s), stored password is missing or expired", prompt.prompt)
+		}
+		level.Error(logger).Log("msg", "Timeout executing dsmadmc")
+		return "", ctx.Err()
+	}
+	if err != nil {
+		if strings.Contains(stdout.String(), "No match found using this criteria") {
+			return "", nil
+		}
+		if _, ok := err.(*ssh.ExitError); !ok {
+			b.drop(target, client)
+		}
+		level.Error(logger).Log("msg", "Error executing dsmadmc", "err", stderr.String(), "out", stdout.String())
+		return "", err
+	}
+	level.Debug(logger).Log("msg", "query output", "out", stdout.String())
+	return stdout.String(), nil
+}
+
+// shellJoin quotes arguments for the remote shell
+func shellJoin(args []string) string {
+	var quoted []string
+	for _, arg := range args {
+		quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'\''`)+"'")
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,295 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/treydock/tsm_exporter/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshServer starts an in-process SSH server that answers dsmadmc commands
+// and returns a target configured to use it
+func sshServer(t *testing.T) (*config.Target, func()) {
+	dir := t.TempDir()
+	hostKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "id_ecdsa")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: clientDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	clientPublic, err := ssh.NewPublicKey(&clientKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "tsm" && bytes.Equal(key.Marshal(), clientPublic.Marshal()) {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{listener.Addr().String()}, hostSigner.PublicKey())
+	if err := os.WriteFile(knownHostsFile, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go sshServeConn(conn, serverConfig)
+		}
+	}()
+	target := &config.Target{
+		Name:       "ssh",
+		Servername: "tsm1",
+		Id:         "admin",
+		Password:   "secret",
+		Backend:    config.BackendSSH,
+		SSH: &config.SSHConfig{
+			Host:           listener.Addr().String(),
+			User:           "tsm",
+			KeyFile:        keyFile,
+			KnownHostsFile: knownHostsFile,
+		},
+	}
+	return target, func() { listener.Close() }
+}
+
+func sshServeConn(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type != "exec" {
+					_ = req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Command string }
+				_ = ssh.Unmarshal(req.Payload, &payload)
+				_ = req.Reply(true, nil)
+				status := uint32(0)
+				switch {
+				case strings.HasPrefix(payload.Command, "'env' 'DSM_DIR=/opt/tsm1' '/opt/tsm1/bin/dsmadmc' '-SERVERName=tsm1' "):
+					_, _ = channel.Write([]byte("SP03,env\n"))
+				case strings.HasPrefix(payload.Command, "'dsmadmc' '-SERVERName=tsm1' '-DATAONLY=YES' '-COMMAdelimited'"):
+					_, _ = channel.Write([]byte("Enter your password:  "))
+					time.Sleep(2 * time.Second)
+				case !strings.HasPrefix(payload.Command, "'dsmadmc' '-SERVERName=tsm1' '-ID=admin' '-PAssword=secret' '-DATAONLY=YES' '-COMMAdelimited'"):
+					_, _ = channel.Stderr().Write([]byte("unexpected command\n"))
+					status = 2
+				case strings.HasSuffix(payload.Command, "'hang'"):
+					time.Sleep(2 * time.Second)
+				case strings.HasSuffix(payload.Command, "'nomatch'"):
+					_, _ = channel.Write([]byte("ANR2034E SELECT: No match found using this criteria.\n"))
+					status = 11
+				case strings.HasSuffix(payload.Command, "'error'"):
+					_, _ = channel.Write([]byte("ANR2000E Unknown command - ERROR.\n"))
+					status = 3
+				default:
+					_, _ = channel.Write([]byte("SP03,foo\n"))
+				}
+				_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				return
+			}
+		}()
+	}
+}
+
+func TestSSHQuery(t *testing.T) {
+	target, cleanup := sshServer(t)
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := dsmadmcQuery(target, "SELECT 'foo' FROM status", ctx, log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != "SP03,foo\n" {
+		t.Errorf("Unexpected out: %q", out)
+	}
+	out, err = dsmadmcQuery(target, "nomatch", ctx, log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != "" {
+		t.Errorf("Unexpected out: %q", out)
+	}
+	if _, err := dsmadmcQuery(target, "error", ctx, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+}
+
+func TestSSHQueryEnvironment(t *testing.T) {
+	target, cleanup := sshServer(t)
+	defer cleanup()
+	target.DsmDir = "/opt/tsm1"
+	target.DsmadmcPath = "/opt/tsm1/bin/dsmadmc"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := dsmadmcQuery(target, "query", ctx, log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != "SP03,env\n" {
+		t.Errorf("Unexpected out: %q", out)
+	}
+}
+
+func TestSSHQueryTimeout(t *testing.T) {
+	target, cleanup := sshServer(t)
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := dsmadmcQuery(target, "hang", ctx, log.NewNopLogger()); err != context.DeadlineExceeded {
+		t.Errorf("Expected timeout, got %v", err)
+	}
+}
+
+func TestSSHQueryUnknownHost(t *testing.T) {
+	target, cleanup := sshServer(t)
+	defer cleanup()
+	if err := os.WriteFile(target.SSH.KnownHostsFile, []byte{}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	target.Name = "ssh-unknown-host"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := dsmadmcQuery(target, "query", ctx, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected host key error")
+	}
+}
+
+func TestSSHQueryStoredPrompt(t *testing.T) {
+	target, cleanup := sshServer(t)
+	defer cleanup()
+	target.Name = "ssh-stored"
+	target.Login = config.LoginStored
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := dsmadmcQuery(target, "query", ctx, log.NewNopLogger())
+	if err == nil || !strings.Contains(err.Error(), "dsmadmc prompted for credentials (Enter your password:)") {
+		t.Errorf("Expected prompt error, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Prompt was not detected before the server gave up, took %v", d)
+	}
+}
+
+func TestSSHQueryDialBlocked(t *testing.T) {
+	target, cleanup := sshServer(t)
+	defer cleanup()
+	// A host that accepts connections but never completes the SSH handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	blocked := &config.Target{Name: "ssh-blocked", Servername: "tsm1", Id: "admin", Password: "secret", Backend: config.BackendSSH,
+		SSH: &config.SSHConfig{Host: listener.Addr().String(), User: "tsm", KeyFile: target.SSH.KeyFile, KnownHostsFile: target.SSH.KnownHostsFile}}
+	blockedCtx, blockedCancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer blockedCancel()
+	errs := make(chan error, 1)
+	go func() {
+		_, err := dsmadmcQuery(blocked, "query", blockedCtx, log.NewNopLogger())
+		errs <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := dsmadmcQuery(target, "query", ctx, log.NewNopLogger()); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if d := time.Since(start); d > 250*time.Millisecond {
+		t.Errorf("Query was blocked by the dial of another target for %v", d)
+	}
+	select {
+	case err := <-errs:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Expected timeout, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Blocked dial did not honor the query timeout")
+	}
+}
+
+func TestShellJoin(t *testing.T) {
+	out := shellJoin([]string{"dsmadmc", "SELECT * FROM foo WHERE a='b'"})
+	expected := `'dsmadmc' 'SELECT * FROM foo WHERE a='\''b'\'''`
+	if out != expected {
+		t.Errorf("Unexpected out:\nExpected: %s\nGot: %s", expected, out)
+	}
+}
@@ -37,6 +37,7 @@ type StatusMetric struct {
 
 type StatusCollector struct {
 	status *prometheus.Desc
+	ctx    context.Context
 	target *config.Target
 	logger log.Logger
 }
@@ -45,10 +46,11 @@ func init() {
 	registerCollector("status", true, NewStatusExporter)
 }
 
-func NewStatusExporter(target *config.Target, logger log.Logger) Collector {
+func NewStatusExporter(ctx context.Context, target *config.Target, logger log.Logger) Collector {
 	return &StatusCollector{
 		status: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "status"),
 			"Status of TSM, 1=online 0=failure", nil, nil),
+		ctx:    ctx,
 		target: target,
 		logger: logger,
 	}
@@ -82,7 +84,7 @@ func (c *StatusCollector) Collect(ch chan<- prometheus.Metric) {
 }
 
 func (c *StatusCollector) collect() (StatusMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*statusTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(c.ctx, collectorTimeout(c.target, "status", *statusTimeout))
 	defer cancel()
 	out, err := DsmadmcStatusExec(c.target, ctx, c.logger)
 	if err != nil {
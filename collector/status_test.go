@@ -86,7 +86,7 @@ func TestStatusCollector(t *testing.T) {
     # TYPE tsm_status gauge
     tsm_status 1
 	`
-	collector := NewStatusExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewStatusExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -112,7 +112,7 @@ func TestStatusCollectorError(t *testing.T) {
     # TYPE tsm_status gauge
     tsm_status 0
 	`
-	collector := NewStatusExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewStatusExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -138,7 +138,7 @@ func TestStatusCollectorTimeout(t *testing.T) {
     # TYPE tsm_status gauge
     tsm_status 0
 	`
-	collector := NewStatusExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewStatusExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
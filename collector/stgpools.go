@@ -72,6 +72,7 @@ type StoragePoolCollector struct {
 	LocalEstimatedCapacity *prometheus.Desc
 	LocalPercentLogical    *prometheus.Desc
 	LocalPercentUtilized   *prometheus.Desc
+	ctx                    context.Context
 	target                 *config.Target
 	logger                 log.Logger
 }
@@ -80,7 +81,7 @@ func init() {
 	registerCollector("stgpools", true, NewStoragePoolExporter)
 }
 
-func NewStoragePoolExporter(target *config.Target, logger log.Logger) Collector {
+func NewStoragePoolExporter(ctx context.Context, target *config.Target, logger log.Logger) Collector {
 	labels := []string{"storagepool", "pooltype", "classname", "storagetype"}
 	return &StoragePoolCollector{
 		PercentLogical: prometheus.NewDesc(prometheus.BuildFQName(namespace, "storage_pool", "logical_ratio"),
@@ -99,6 +100,7 @@ func NewStoragePoolExporter(target *config.Target, logger log.Logger) Collector
 			"Storage pool local logical occupancy ratio, 0.0-1.0", labels, nil),
 		LocalPercentUtilized: prometheus.NewDesc(prometheus.BuildFQName(namespace, "storage_pool", "local_utilized_ratio"),
 			"Storage pool local utilized ratio, 0.0-1.0", labels, nil),
+		ctx:    ctx,
 		target: target,
 		logger: logger,
 	}
@@ -162,7 +164,7 @@ func (c *StoragePoolCollector) Collect(ch chan<- prometheus.Metric) {
 }
 
 func (c *StoragePoolCollector) collect() ([]StoragePoolMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*stgpoolsTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(c.ctx, collectorTimeout(c.target, "stgpools", *stgpoolsTimeout))
 	defer cancel()
 	out, err := DsmadmcStoragePoolExec(c.target, ctx, c.logger)
 	if err != nil {
@@ -117,7 +117,7 @@ func TestStoragePoolCollector(t *testing.T) {
 	`
 	w := log.NewSyncWriter(os.Stderr)
 	logger := log.NewLogfmtLogger(w)
-	collector := NewStoragePoolExporter(&config.Target{}, logger)
+	collector := NewStoragePoolExporter(context.Background(), &config.Target{}, logger)
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -149,7 +149,7 @@ func TestStoragePoolCollectorError(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="stgpools"} 0
 	`
-	collector := NewStoragePoolExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewStoragePoolExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -177,7 +177,7 @@ func TestStoragePoolCollectorTimeout(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="stgpools"} 1
 	`
-	collector := NewStoragePoolExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewStoragePoolExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -0,0 +1,70 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// promptScanLimit is how much output is checked for credential prompts, dsmadmc prompts before any data
+	promptScanLimit = 4096
+	// promptOverlap is how much previously written output is checked again so a prompt split across writes is found
+	promptOverlap = 64
+)
+
+var (
+	credentialPrompt = regexp.MustCompile(`(?i)(enter your user id|enter (your )?(new )?password|password (has )?expired)[^\n:]*:?`)
+)
+
+// promptWriter watches dsmadmc output for credential prompts when using stored passwords.
+// dsmadmc would otherwise wait on the prompt until the collector timeout.
+type promptWriter struct {
+	sync.Mutex
+	w      *bytes.Buffer
+	cancel context.CancelFunc
+	prompt string
+}
+
+func (p *promptWriter) Write(b []byte) (int, error) {
+	p.Lock()
+	defer p.Unlock()
+	start := p.w.Len()
+	n, err := p.w.Write(b)
+	if p.prompt == "" && start < promptScanLimit {
+		out := p.w.Bytes()
+		if len(out) > promptScanLimit {
+			out = out[:promptScanLimit]
+		}
+		if start > promptOverlap {
+			out = out[start-promptOverlap:]
+		}
+		if match := credentialPrompt.Find(out); match != nil {
+			p.prompt = strings.TrimSpace(string(match))
+			p.cancel()
+		}
+	}
+	return n, err
+}
+
+// found returns the credential prompt and the output written so far
+func (p *promptWriter) found() (string, string) {
+	p.Lock()
+	defer p.Unlock()
+	return p.prompt, p.w.String()
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/treydock/tsm_exporter/config"
+)
+
+func TestDsmadmcQueryStored(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "SP03,foo\n"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	target := &config.Target{Servername: "tsm1", Login: config.LoginStored}
+	out, err := dsmadmcQuery(target, "query", ctx, log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != mockedStdout {
+		t.Errorf("Unexpected out: %q", out)
+	}
+	for _, arg := range mockedArgs {
+		if strings.HasPrefix(arg, "-ID=") || strings.HasPrefix(arg, "-PAssword=") {
+			t.Errorf("Unexpected credential argument %s", arg)
+		}
+	}
+}
+
+func TestDsmadmcQueryStoredPrompt(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "SP03,foo\n"
+	mockedPassword = "secret"
+	defer func() {
+		execCommand = exec.CommandContext
+		mockedPassword = ""
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	target := &config.Target{Servername: "tsm1", Login: config.LoginStored}
+	_, err := dsmadmcQuery(target, "query", ctx, log.NewNopLogger())
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	if err == context.DeadlineExceeded {
+		t.Errorf("Expected prompt error, got timeout")
+	}
+	if !strings.Contains(err.Error(), "dsmadmc prompted for credentials (Enter your password:)") {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+}
+
+func TestDsmadmcQueryStoredPool(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--dsmadmc.pool.size=2"}); err != nil {
+		t.Fatal(err)
+	}
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "SP03,foo\n"
+	mockedPassword = "secret"
+	defer func() {
+		execCommand = exec.CommandContext
+		mockedPassword = ""
+		_, _ = kingpin.CommandLine.Parse([]string{})
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	target := &config.Target{Name: "stored-pool", Servername: "tsm1", Login: config.LoginStored}
+	_, err := dsmadmcQuery(target, "query", ctx, log.NewNopLogger())
+	if err == nil || !strings.Contains(err.Error(), "dsmadmc prompted for credentials") {
+		t.Errorf("Expected prompt error, got %v", err)
+	}
+	poolsLock.Lock()
+	defer poolsLock.Unlock()
+	if _, ok := pools[target.Name]; ok {
+		t.Errorf("Stored login target should not use the session pool")
+	}
+}
+
+func TestPromptWriter(t *testing.T) {
+	var canceled int
+	var stdout bytes.Buffer
+	prompt := &promptWriter{w: &stdout, cancel: func() { canceled++ }}
+	for _, b := range []string{"Enter your pass", "word:  "} {
+		if _, err := prompt.Write([]byte(b)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if prompt.prompt != "Enter your password:" {
+		t.Errorf("Unexpected prompt %q", prompt.prompt)
+	}
+	if canceled != 1 {
+		t.Errorf("Unexpected cancel count %d", canceled)
+	}
+}
+
+func TestPromptWriterData(t *testing.T) {
+	var canceled int
+	var stdout bytes.Buffer
+	prompt := &promptWriter{w: &stdout, cancel: func() { canceled++ }}
+	row := []byte(strings.Repeat("VOL0001L5,LIBRARY,FULL,100.0\n", 100))
+	for i := 0; i < 10; i++ {
+		if _, err := prompt.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := prompt.Write([]byte("NODE1,password expired,1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if prompt.prompt != "" {
+		t.Errorf("Unexpected prompt %q", prompt.prompt)
+	}
+	if canceled != 0 {
+		t.Errorf("Unexpected cancel count %d", canceled)
+	}
+	if stdout.Len() != 10*len(row)+25 {
+		t.Errorf("Unexpected output length %d", stdout.Len())
+	}
+}
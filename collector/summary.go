@@ -27,6 +27,11 @@ import (
 	"github.com/treydock/tsm_exporter/config"
 )
 
+const (
+	// tapeMountWindow is how far back tape mounts are queried
+	tapeMountWindow = time.Hour
+)
+
 var (
 	summaryTimeout     = kingpin.Flag("collector.summary.timeout", "Timeout for collecting summary information").Default("5").Int()
 	DsmadmcSummaryExec = dsmadmcSummary
@@ -49,6 +54,7 @@ type SummaryCollector struct {
 	bytes              *prometheus.Desc
 	tapeMountStartTime *prometheus.Desc
 	tapeMountEndTime   *prometheus.Desc
+	ctx                context.Context
 	target             *config.Target
 	logger             log.Logger
 }
@@ -57,7 +63,7 @@ func init() {
 	registerCollector("summary", true, NewSummaryExporter)
 }
 
-func NewSummaryExporter(target *config.Target, logger log.Logger) Collector {
+func NewSummaryExporter(ctx context.Context, target *config.Target, logger log.Logger) Collector {
 	labels := []string{"activity", "entity", "schedule"}
 	tapeMountLabels := []string{"volume", "drive"}
 	return &SummaryCollector{
@@ -71,6 +77,7 @@ func NewSummaryExporter(target *config.Target, logger log.Logger) Collector {
 			"Start time of activity", tapeMountLabels, nil),
 		tapeMountEndTime: prometheus.NewDesc(prometheus.BuildFQName(namespace, "tape_mount", "end_timestamp_seconds"),
 			"End time of activity", tapeMountLabels, nil),
+		ctx:    ctx,
 		target: target,
 		logger: logger,
 	}
@@ -113,7 +120,7 @@ func (c *SummaryCollector) Collect(ch chan<- prometheus.Metric) {
 }
 
 func (c *SummaryCollector) collect() (map[string]SummaryMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*summaryTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(c.ctx, collectorTimeout(c.target, "summary", *summaryTimeout))
 	defer cancel()
 	var summaryOut, tapeMountOut string
 	var summaryErr, tapeMountErr error
@@ -140,8 +147,8 @@ func (c *SummaryCollector) collect() (map[string]SummaryMetric, error) {
 
 func buildSummaryQuery(target *config.Target) string {
 	query := "SELECT ACTIVITY,ENTITY,SCHEDULE_NAME,SUM(BYTES),MIN(START_TIME),MAX(END_TIME) FROM SUMMARY_EXTENDED"
-	if target.SummaryActivities != nil {
-		query = query + fmt.Sprintf(" WHERE ACTIVITY IN (%s)", buildInFilter(target.SummaryActivities))
+	if activities := target.Options("summary").SummaryActivities; activities != nil {
+		query = query + fmt.Sprintf(" WHERE ACTIVITY IN (%s)", buildInFilter(activities))
 	} else {
 		query = query + " WHERE ACTIVITY NOT IN ('TAPE MOUNT','EXPIRATION','PROCESS_START','PROCESS_END') AND ACTIVITY NOT LIKE 'SUR_%'"
 	}
@@ -149,9 +156,13 @@ func buildSummaryQuery(target *config.Target) string {
 	return query
 }
 
-func buildTapeMountQuery() string {
+func buildTapeMountQuery(target *config.Target) string {
+	window := target.Options("summary").Window
+	if window == 0 {
+		window = tapeMountWindow
+	}
 	now := timeNow().Format(timeFormat)
-	past := timeNow().Add(-time.Hour * 1).Format(timeFormat)
+	past := timeNow().Add(-window).Format(timeFormat)
 	query := "SELECT ACTIVITY,VOLUME_NAME,DRIVE_NAME,START_TIME,END_TIME FROM SUMMARY_EXTENDED"
 	query = query + " WHERE ACTIVITY IN ('TAPE MOUNT')"
 	query = query + fmt.Sprintf(" AND END_TIME BETWEEN '%s' AND '%s'", past, now)
@@ -162,7 +173,7 @@ func buildTapeMountQuery() string {
 func dsmadmcSummary(target *config.Target, tapeMount bool, ctx context.Context, logger log.Logger) (string, error) {
 	var query string
 	if tapeMount {
-		query = buildTapeMountQuery()
+		query = buildTapeMountQuery(target)
 	} else {
 		query = buildSummaryQuery(target)
 	}
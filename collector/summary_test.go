@@ -66,7 +66,23 @@ func TestBuildTapeMountQuery(t *testing.T) {
 	}
 	expectedQuery := "SELECT ACTIVITY,VOLUME_NAME,DRIVE_NAME,START_TIME,END_TIME FROM SUMMARY_EXTENDED"
 	expectedQuery = expectedQuery + " WHERE ACTIVITY IN ('TAPE MOUNT') AND END_TIME BETWEEN '2020-07-02 12:00:00.000000' AND '2020-07-02 13:00:00.000000' ORDER BY END_TIME DESC"
-	query := buildTapeMountQuery()
+	query := buildTapeMountQuery(&config.Target{})
+	if query != expectedQuery {
+		t.Errorf("\nExpected: %s\nGot: %s", expectedQuery, query)
+	}
+}
+
+func TestBuildTapeMountQueryWindow(t *testing.T) {
+	mockNow, _ := time.Parse("01/02/2006 15:04:05", "07/02/2020 13:00:00")
+	timeNow = func() time.Time {
+		return mockNow
+	}
+	target := &config.Target{
+		CollectorOptions: map[string]*config.CollectorOptions{"summary": {Window: 30 * time.Minute}},
+	}
+	expectedQuery := "SELECT ACTIVITY,VOLUME_NAME,DRIVE_NAME,START_TIME,END_TIME FROM SUMMARY_EXTENDED"
+	expectedQuery = expectedQuery + " WHERE ACTIVITY IN ('TAPE MOUNT') AND END_TIME BETWEEN '2020-07-02 12:30:00.000000' AND '2020-07-02 13:00:00.000000' ORDER BY END_TIME DESC"
+	query := buildTapeMountQuery(target)
 	if query != expectedQuery {
 		t.Errorf("\nExpected: %s\nGot: %s", expectedQuery, query)
 	}
@@ -150,7 +166,7 @@ func TestSummaryCollector(t *testing.T) {
 	tsm_tape_mount_start_timestamp_seconds{drive="TAPE05",volume="F02757L7"} 1667257561
 	tsm_tape_mount_start_timestamp_seconds{drive="TAPE10",volume="F02762L7"} 1667262593
 	`
-	collector := NewSummaryExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewSummaryExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -180,7 +196,7 @@ func TestSummaryCollectorError(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="summary"} 0
 	`
-	collector := NewSummaryExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewSummaryExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -209,7 +225,7 @@ func TestSummaryCollectorTimeout(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="summary"} 1
 	`
-	collector := NewSummaryExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewSummaryExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
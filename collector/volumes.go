@@ -55,6 +55,7 @@ type VolumesCollector struct {
 	status        *prometheus.Desc
 	times_mounted *prometheus.Desc
 	write_pass    *prometheus.Desc
+	ctx           context.Context
 	target        *config.Target
 	logger        log.Logger
 }
@@ -63,7 +64,7 @@ func init() {
 	registerCollector("volumes", true, NewVolumesExporter)
 }
 
-func NewVolumesExporter(target *config.Target, logger log.Logger) Collector {
+func NewVolumesExporter(ctx context.Context, target *config.Target, logger log.Logger) Collector {
 	return &VolumesCollector{
 		unavailable: prometheus.NewDesc(prometheus.BuildFQName(namespace, "volumes", "unavailable"),
 			"Number of unavailable volumes", nil, nil),
@@ -81,6 +82,7 @@ func NewVolumesExporter(target *config.Target, logger log.Logger) Collector {
 			"Volume times mounted", []string{"volume", "classname"}, nil),
 		write_pass: prometheus.NewDesc(prometheus.BuildFQName(namespace, "volume", "write_pass"),
 			"Volume write pass", []string{"volume", "classname"}, nil),
+		ctx:    ctx,
 		target: target,
 		logger: logger,
 	}
@@ -147,13 +149,17 @@ func (c *VolumesCollector) Collect(ch chan<- prometheus.Metric) {
 }
 
 func (c *VolumesCollector) collect() ([]VolumeMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*volumesTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(c.ctx, collectorTimeout(c.target, "volumes", *volumesTimeout))
 	defer cancel()
 	out, err := DsmadmcVolumesExec(c.target, ctx, c.logger)
 	if err != nil {
 		return nil, err
 	}
-	metrics, err := volumesParse(out, c.logger)
+	classnameExclude := *volumesClassnameExclude
+	if exclude := c.target.Options("volumes").ClassnameExclude; exclude != "" {
+		classnameExclude = exclude
+	}
+	metrics, err := volumesParse(out, classnameExclude, c.logger)
 	return metrics, err
 }
 
@@ -163,8 +169,8 @@ func dsmadmcVolumes(target *config.Target, ctx context.Context, logger log.Logge
 	return out, err
 }
 
-func volumesParse(out string, logger log.Logger) ([]VolumeMetric, error) {
-	classnameExcludePattern := regexp.MustCompile(*volumesClassnameExclude)
+func volumesParse(out string, classnameExclude string, logger log.Logger) ([]VolumeMetric, error) {
+	classnameExcludePattern := regexp.MustCompile(classnameExclude)
 	var metrics []VolumeMetric
 	records, err := getRecords(out, logger)
 	if err != nil {
@@ -177,7 +183,7 @@ func volumesParse(out string, logger log.Logger) ([]VolumeMetric, error) {
 		var metric VolumeMetric
 		metric.name = record[4]
 		metric.classname = record[3]
-		if *volumesClassnameExclude != "" && classnameExcludePattern.MatchString(metric.classname) {
+		if classnameExclude != "" && classnameExcludePattern.MatchString(metric.classname) {
 			level.Debug(logger).Log("msg", "Skipping volume due to classname exclude", "volume", metric.name, "classname", metric.classname)
 			continue
 		}
@@ -46,7 +46,7 @@ READONLY,"5735346,0","94,6",DCULT7,F00529L7,STGPOOL3,FULL,1,1
 )
 
 func TestVolumesParse(t *testing.T) {
-	metrics, err := volumesParse(mockVolumeStdout, log.NewNopLogger())
+	metrics, err := volumesParse(mockVolumeStdout, "", log.NewNopLogger())
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 		return
@@ -60,7 +60,7 @@ func TestVolumesParse(t *testing.T) {
 }
 
 func TestVolumesParseComma(t *testing.T) {
-	metrics, err := volumesParse(mockVolumeStdoutComma, log.NewNopLogger())
+	metrics, err := volumesParse(mockVolumeStdoutComma, "", log.NewNopLogger())
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 		return
@@ -82,7 +82,7 @@ func TestVolumesParseError(t *testing.T) {
 		"UNAVAILABLE,\"8199467\",0\",\"68,5\",DCULT7,F00640L7,STGPOOL1,FULL,1,1",
 	}
 	for i, out := range tests {
-		_, err := volumesParse(out, log.NewNopLogger())
+		_, err := volumesParse(out, "", log.NewNopLogger())
 		if err == nil {
 			t.Errorf("Expected error for test case %d", i)
 		}
@@ -158,7 +158,7 @@ func TestVolumesCollector(t *testing.T) {
 	`
 	w := log.NewSyncWriter(os.Stderr)
 	logger := log.NewLogfmtLogger(w)
-	collector := NewVolumesExporter(&config.Target{}, logger)
+	collector := NewVolumesExporter(context.Background(), &config.Target{}, logger)
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -172,6 +172,25 @@ func TestVolumesCollector(t *testing.T) {
 	}
 }
 
+func TestVolumesCollectorTargetClassnameExclude(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	DsmadmcVolumesExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return mockVolumeStdout, nil
+	}
+	target := &config.Target{
+		CollectorOptions: map[string]*config.CollectorOptions{"volumes": {ClassnameExclude: "^DCULT7$"}},
+	}
+	collector := NewVolumesExporter(context.Background(), target, log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers, "tsm_volume_storage_pool_info"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 2 {
+		t.Errorf("Unexpected collection count %d, expected 2", val)
+	}
+}
+
 func TestVolumesCollectorError(t *testing.T) {
 	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
 		t.Fatal(err)
@@ -187,7 +206,7 @@ func TestVolumesCollectorError(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="volumes"} 0
 	`
-	collector := NewVolumesExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewVolumesExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -216,7 +235,7 @@ func TestVolumesCollectorTimeout(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="volumes"} 1
 	`
-	collector := NewVolumesExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewVolumesExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -37,6 +37,7 @@ type VolumeUsageMetric struct {
 
 type VolumeUsagesCollector struct {
 	usage  *prometheus.Desc
+	ctx    context.Context
 	target *config.Target
 	logger log.Logger
 }
@@ -45,10 +46,11 @@ func init() {
 	registerCollector("volumeusage", true, NewVolumeUsagesExporter)
 }
 
-func NewVolumeUsagesExporter(target *config.Target, logger log.Logger) Collector {
+func NewVolumeUsagesExporter(ctx context.Context, target *config.Target, logger log.Logger) Collector {
 	return &VolumeUsagesCollector{
 		usage: prometheus.NewDesc(prometheus.BuildFQName(namespace, "volume", "usage"),
 			"Number of volumes used by node name", []string{"nodename", "volumename"}, nil),
+		ctx:    ctx,
 		target: target,
 		logger: logger,
 	}
@@ -83,7 +85,7 @@ func (c *VolumeUsagesCollector) Collect(ch chan<- prometheus.Metric) {
 }
 
 func (c *VolumeUsagesCollector) collect() ([]VolumeUsageMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*volumeusageTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(c.ctx, collectorTimeout(c.target, "volumeusage", *volumeusageTimeout))
 	defer cancel()
 	out, err := DsmadmcVolumeUsagesExec(c.target, ctx, c.logger)
 	if err != nil {
@@ -101,6 +103,7 @@ func dsmadmcVolumeUsages(target *config.Target, ctx context.Context, logger log.
 
 func volumeusageParse(out string, target *config.Target, logger log.Logger) ([]VolumeUsageMetric, error) {
 	nodeVolumes := make(map[string][]string)
+	volumeUsageMap := target.Options("volumeusage").VolumeUsageMap
 	var metrics []VolumeUsageMetric
 	records, err := getRecords(out, logger)
 	if err != nil {
@@ -118,10 +121,10 @@ func volumeusageParse(out string, target *config.Target, logger log.Logger) ([]V
 		metric.nodename = nodename
 		for _, volume := range volumes {
 			var volumename string
-			if target.VolumeUsageMap == nil {
+			if volumeUsageMap == nil {
 				volumename = "all"
 			} else {
-				for name, regex := range target.VolumeUsageMap {
+				for name, regex := range volumeUsageMap {
 					pattern := regexp.MustCompile(regex)
 					if pattern.MatchString(volume) {
 						volumename = name
@@ -116,7 +116,7 @@ func TestVolumeUsagesCollector(t *testing.T) {
 		"LTO6": "^E",
 		"LTO7": "^F",
 	}}
-	collector := NewVolumeUsagesExporter(target, log.NewNopLogger())
+	collector := NewVolumeUsagesExporter(context.Background(), target, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -145,7 +145,7 @@ func TestVolumeUsagesCollectorError(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="volumeusage"} 0
 	`
-	collector := NewVolumeUsagesExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewVolumeUsagesExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -174,7 +174,7 @@ func TestVolumeUsagesCollectorTimeout(t *testing.T) {
     # TYPE tsm_exporter_collect_timeout gauge
     tsm_exporter_collect_timeout{collector="volumeusage"} 1
 	`
-	collector := NewVolumeUsagesExporter(&config.Target{}, log.NewNopLogger())
+	collector := NewVolumeUsagesExporter(context.Background(), &config.Target{}, log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -0,0 +1,63 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+var (
+	// collectorNames are the names of the collectors registered by the collector package
+	collectorNames = make(map[string]bool)
+)
+
+// RegisterCollector records the name of a collector so the configuration can be checked against it,
+// the collector package registers each of its collectors when it is initialized
+func RegisterCollector(name string) {
+	collectorNames[name] = true
+}
+
+// IsCollector checks if name is the name of a registered collector
+func IsCollector(name string) bool {
+	return collectorNames[name]
+}
+
+// isCollector checks if name is the name of a registered collector or of a query of the configuration
+func (c *Config) isCollector(name string) bool {
+	if IsCollector(name) {
+		return true
+	}
+	for _, query := range c.Queries {
+		if query.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCollectorNames checks the keys of a map of owner's field, such as 'refresh', are collector or query names
+func (c *Config) validateCollectorNames(owner string, field string, values map[string]string) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !c.isCollector(name) {
+			return fmt.Errorf("%s has unknown collector %s in '%s'", owner, name, field)
+		}
+	}
+	return nil
+}
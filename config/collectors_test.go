@@ -0,0 +1,36 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// The collector package registers its collectors, which the config package can not import
+	for _, name := range []string{"db", "drives", "events", "libvolumes", "log", "occupancy", "replicationview", "status", "stgpools", "summary", "volumes", "volumeusage"} {
+		RegisterCollector(name)
+	}
+	os.Exit(m.Run())
+}
+
+func TestIsCollector(t *testing.T) {
+	if !IsCollector("volumes") {
+		t.Errorf("Expected volumes to be a collector")
+	}
+	if IsCollector("sessions") {
+		t.Errorf("Unexpected collector sessions")
+	}
+}
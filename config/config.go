@@ -14,39 +14,136 @@
 package config
 
 import (
+	"container/list"
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	yaml "gopkg.in/yaml.v3"
 )
 
+const (
+	LoginArgv   = "argv"
+	LoginPty    = "pty"
+	LoginStored = "stored"
+
+	BackendDsmadmc = "dsmadmc"
+	BackendRest    = "rest"
+	BackendSSH     = "ssh"
+)
+
+var (
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tsm_exporter",
+		Name:      "config_last_reload_successful",
+		Help:      "TSM exporter config loaded successfully.",
+	})
+	configReloadSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tsm_exporter",
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful configuration reload.",
+	})
+	dsmSysInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tsm_exporter",
+		Name:      "dsm_sys_info",
+		Help:      "Server stanzas of dsm.sys with their address and port.",
+	}, []string{"servername", "address", "port"})
+)
+
+func init() {
+	prometheus.MustRegister(configReloadSuccess)
+	prometheus.MustRegister(configReloadSeconds)
+	prometheus.MustRegister(dsmSysInfo)
+}
+
 type Config struct {
-	Targets map[string]*Target `yaml:"targets"`
+	Targets  map[string]*Target `yaml:"targets"`
+	Queries  []*Query           `yaml:"queries,omitempty"`
+	Refresh  map[string]string  `yaml:"refresh,omitempty"`
+	Fallback map[string]string  `yaml:"fallback,omitempty"`
+	Modules  map[string]*Module `yaml:"modules,omitempty"`
+	Auth     map[string]*Auth   `yaml:"auth,omitempty"`
+	DsmSys   *DsmSysConfig      `yaml:"dsm_sys,omitempty"`
+
+	dsmSysServers map[string]*DsmSysServer
+	patterns      []*targetPattern
+	resolved      map[string]*list.Element
+	resolvedOrder *list.List
+	moduleTargets map[string]*Target
+	resolvedLock  sync.Mutex
+	evicted       func(name string)
 }
 
 type SafeConfig struct {
 	sync.RWMutex
 	C *Config
+	// Evicted is called with the name of a target resolved from a pattern when it is evicted from the cache
+	Evicted func(name string)
 }
 
 type Target struct {
-	sync.Mutex
 	Name                 string
-	Servername           string            `yaml:"servername"`
-	Id                   string            `yaml:"id"`
-	Password             string            `yaml:"password"`
-	Timezone             string            `yaml:"timezone"`
-	LibraryName          string            `yaml:"library_name"`
-	Schedules            []string          `yaml:"schedules"`
-	ReplicationNodeNames []string          `yaml:"replication_node_names"`
-	Collectors           []string          `yaml:"collectors,omitempty"`
-	VolumeUsageMap       map[string]string `yaml:"volumeusage_map,omitempty"`
-	SummaryActivities    []string          `yaml:"summary_activities,omitempty"`
+	Servername           string                       `yaml:"servername"`
+	Id                   string                       `yaml:"id"`
+	Password             string                       `yaml:"password"`
+	PasswordFile         string                       `yaml:"password_file"`
+	PasswordEnv          string                       `yaml:"password_env"`
+	PasswordCommand      string                       `yaml:"password_command"`
+	Login                string                       `yaml:"login"`
+	Backend              string                       `yaml:"backend"`
+	DsmDir               string                       `yaml:"dsm_dir"`
+	DsmConfig            string                       `yaml:"dsm_config"`
+	DsmLog               string                       `yaml:"dsm_log"`
+	DsmadmcPath          string                       `yaml:"dsmadmc_path"`
+	MaxSessions          int                          `yaml:"max_sessions"`
+	Rest                 *RestConfig                  `yaml:"rest,omitempty"`
+	SSH                  *SSHConfig                   `yaml:"ssh,omitempty"`
+	Timezone             string                       `yaml:"timezone"`
+	LibraryName          string                       `yaml:"library_name"`
+	Schedules            []string                     `yaml:"schedules"`
+	ReplicationNodeNames []string                     `yaml:"replication_node_names"`
+	Collectors           []string                     `yaml:"collectors,omitempty"`
+	VolumeUsageMap       map[string]string            `yaml:"volumeusage_map,omitempty"`
+	SummaryActivities    []string                     `yaml:"summary_activities,omitempty"`
+	CollectorOptions     map[string]*CollectorOptions `yaml:"collector_options,omitempty"`
+	Labels               map[string]string            `yaml:"labels,omitempty"`
+	Module               string                       `yaml:"module"`
+	AuthProfile          string                       `yaml:"auth_profile"`
+	Refresh              map[string]string            `yaml:"refresh,omitempty"`
+	Fallback             map[string]string            `yaml:"fallback,omitempty"`
+	Queries              []*Query                     `yaml:"-"`
+	RefreshSchedules     map[string]*RefreshSchedule  `yaml:"-"`
+	FallbackMaxStale     map[string]time.Duration     `yaml:"-"`
+	own                  Module
+	base                 *Target
+}
+
+type RestConfig struct {
+	URL                string `yaml:"url"`
+	Server             string `yaml:"server"`
+	CAFile             string `yaml:"ca_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+type SSHConfig struct {
+	Host           string `yaml:"host"`
+	User           string `yaml:"user"`
+	KeyFile        string `yaml:"key_file"`
+	KnownHostsFile string `yaml:"known_hosts"`
 }
 
-func (sc *SafeConfig) ReloadConfig(configFile string) error {
-	var c = &Config{}
+func (sc *SafeConfig) ReloadConfig(configFile string) (err error) {
+	var c = &Config{evicted: sc.Evicted}
+	defer func() {
+		if err != nil {
+			configReloadSuccess.Set(0)
+		} else {
+			configReloadSuccess.Set(1)
+			configReloadSeconds.SetToCurrentTime()
+		}
+	}()
 	yamlReader, err := os.Open(configFile)
 	if err != nil {
 		return fmt.Errorf("Error reading config file %s: %s", configFile, err)
@@ -57,20 +154,116 @@ func (sc *SafeConfig) ReloadConfig(configFile string) error {
 	if err := decoder.Decode(c); err != nil {
 		return fmt.Errorf("Error parsing config file %s: %s", configFile, err)
 	}
+	if err := c.loadDsmSys(); err != nil {
+		return err
+	}
+	if err := c.validateCollectorNames("Configuration", "refresh", c.Refresh); err != nil {
+		return err
+	}
+	if err := c.validateCollectorNames("Configuration", "fallback", c.Fallback); err != nil {
+		return err
+	}
+	for name, module := range c.Modules {
+		if err := c.validateCollectorOptions("Module "+name, module.CollectorOptions); err != nil {
+			return err
+		}
+	}
 	for key := range c.Targets {
 		target := c.Targets[key]
 		target.Name = key
-		if target.Servername == "" {
+		if isTargetPattern(key) {
+			if target.Servername != "" {
+				return fmt.Errorf("Target %s is a pattern and can not define 'servername'", key)
+			}
+		} else if target.Servername == "" {
 			target.Servername = key
 		}
-		if target.Id == "" {
-			return fmt.Errorf("Target %s must define 'id' value", key)
+		if err := target.applyAuth(c.Auth); err != nil {
+			return err
 		}
-		if target.Password == "" {
-			return fmt.Errorf("Target %s must define 'password' value", key)
+		if err := target.resolveModule(c.Modules); err != nil {
+			return err
+		}
+		if err := c.validateCollectorOptions("Target "+key, target.CollectorOptions); err != nil {
+			return err
+		}
+		if target.Login == "" {
+			target.Login = LoginArgv
+		} else if target.Login != LoginArgv && target.Login != LoginPty && target.Login != LoginStored {
+			return fmt.Errorf("Target %s has invalid 'login' value %s, must be one of '%s', '%s' or '%s'", key, target.Login, LoginArgv, LoginPty, LoginStored)
+		}
+		if target.Backend == "" {
+			target.Backend = BackendDsmadmc
+		} else if target.Backend != BackendDsmadmc && target.Backend != BackendRest && target.Backend != BackendSSH {
+			return fmt.Errorf("Target %s has invalid 'backend' value %s, must be one of '%s', '%s' or '%s'", key, target.Backend, BackendDsmadmc, BackendRest, BackendSSH)
+		}
+		if target.Backend == BackendDsmadmc && !isTargetPattern(key) && !c.inDsmSys(target.Servername) {
+			return fmt.Errorf("Target %s servername %s is not defined in dsm.sys %s", key, target.Servername, c.DsmSys.Path)
+		}
+		if target.Backend == BackendSSH {
+			if target.SSH == nil || target.SSH.Host == "" || target.SSH.User == "" || target.SSH.KeyFile == "" || target.SSH.KnownHostsFile == "" {
+				return fmt.Errorf("Target %s must define 'ssh.host', 'ssh.user', 'ssh.key_file' and 'ssh.known_hosts' values when using backend '%s'", key, BackendSSH)
+			}
+			if target.Login == LoginPty {
+				return fmt.Errorf("Target %s can not use login '%s' with backend '%s'", key, LoginPty, BackendSSH)
+			}
+		}
+		if target.Backend == BackendRest {
+			if target.Rest == nil || target.Rest.URL == "" {
+				return fmt.Errorf("Target %s must define 'rest.url' value when using backend '%s'", key, BackendRest)
+			}
+			if target.Login == LoginStored {
+				return fmt.Errorf("Target %s can not use login '%s' with backend '%s'", key, LoginStored, BackendRest)
+			}
+		}
+		if target.MaxSessions < 0 {
+			return fmt.Errorf("Target %s has invalid 'max_sessions' value %d, must be 0 or greater", key, target.MaxSessions)
+		}
+		if target.Login != LoginStored {
+			if target.Id == "" {
+				return fmt.Errorf("Target %s must define 'id' value", key)
+			}
+			if err := target.resolvePassword(); err != nil {
+				return err
+			}
+		}
+		if err := target.validateLabels(); err != nil {
+			return err
+		}
+		if err := c.validateCollectorNames("Target "+key, "refresh", target.Refresh); err != nil {
+			return err
+		}
+		if err := c.validateCollectorNames("Target "+key, "fallback", target.Fallback); err != nil {
+			return err
+		}
+		if err := target.resolveRefresh(c.Refresh); err != nil {
+			return err
+		}
+		if err := target.resolveFallback(c.Fallback); err != nil {
+			return err
 		}
 		c.Targets[key] = target
 	}
+	queryNames := make(map[string]bool)
+	for _, query := range c.Queries {
+		if err := query.validate(c.Targets); err != nil {
+			return err
+		}
+		if queryNames[query.Name] {
+			return fmt.Errorf("Query %s is defined more than once", query.Name)
+		}
+		queryNames[query.Name] = true
+		for key, target := range c.Targets {
+			if query.Targets == nil || sliceContains(query.Targets, key) {
+				target.Queries = append(target.Queries, query)
+			}
+		}
+	}
+	if err := c.splitPatterns(); err != nil {
+		return err
+	}
+	c.resolveModuleTargets()
+	c.updateDsmSysInfo()
 	sc.Lock()
 	sc.C = c
 	sc.Unlock()
@@ -15,6 +15,8 @@ package config
 
 import (
 	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestReloadConfigDefaults(t *testing.T) {
@@ -34,6 +36,18 @@ func TestReloadConfigDefaults(t *testing.T) {
 	}
 }
 
+func TestReloadConfigStoredLogin(t *testing.T) {
+	sc := &SafeConfig{}
+	err := sc.ReloadConfig("testdata/stored-login.yaml")
+	if err != nil {
+		t.Errorf("Unexpected err: %s", err.Error())
+		return
+	}
+	if login := sc.C.Targets["tsm1.example.com"].Login; login != LoginStored {
+		t.Errorf("Unexpected login value %s", login)
+	}
+}
+
 func TestReloadConfigBadConfigs(t *testing.T) {
 	sc := &SafeConfig{}
 	tests := []struct {
@@ -54,7 +68,27 @@ func TestReloadConfigBadConfigs(t *testing.T) {
 		},
 		{
 			ConfigFile:    "testdata/missing-password.yaml",
-			ExpectedError: "Target tsm1.example.com must define 'password' value",
+			ExpectedError: "Target tsm1.example.com must define one of 'password', 'password_file', 'password_env' or 'password_command'",
+		},
+		{
+			ConfigFile:    "testdata/invalid-login.yaml",
+			ExpectedError: "Target tsm1.example.com has invalid 'login' value foo, must be one of 'argv', 'pty' or 'stored'",
+		},
+		{
+			ConfigFile:    "testdata/invalid-backend.yaml",
+			ExpectedError: "Target tsm1.example.com has invalid 'backend' value foo, must be one of 'dsmadmc', 'rest' or 'ssh'",
+		},
+		{
+			ConfigFile:    "testdata/rest-missing-url.yaml",
+			ExpectedError: "Target tsm1.example.com must define 'rest.url' value when using backend 'rest'",
+		},
+		{
+			ConfigFile:    "testdata/ssh-missing-host.yaml",
+			ExpectedError: "Target tsm1.example.com must define 'ssh.host', 'ssh.user', 'ssh.key_file' and 'ssh.known_hosts' values when using backend 'ssh'",
+		},
+		{
+			ConfigFile:    "testdata/invalid-max-sessions.yaml",
+			ExpectedError: "Target tsm1.example.com has invalid 'max_sessions' value -1, must be 0 or greater",
 		},
 	}
 	for i, test := range tests {
@@ -68,3 +102,26 @@ func TestReloadConfigBadConfigs(t *testing.T) {
 		}
 	}
 }
+
+func TestReloadConfigKeepsPreviousOnError(t *testing.T) {
+	sc := &SafeConfig{}
+	if err := sc.ReloadConfig("testdata/tsm_exporter.yaml"); err != nil {
+		t.Fatalf("Unexpected err: %s", err.Error())
+	}
+	if val := testutil.ToFloat64(configReloadSuccess); val != 1 {
+		t.Errorf("Unexpected reload success value, got %v", val)
+	}
+	previous := sc.C
+	if err := sc.ReloadConfig("testdata/missing-id.yaml"); err == nil {
+		t.Fatalf("Expected error")
+	}
+	if val := testutil.ToFloat64(configReloadSuccess); val != 0 {
+		t.Errorf("Unexpected reload success value, got %v", val)
+	}
+	if sc.C != previous {
+		t.Errorf("Config was replaced by invalid config")
+	}
+	if _, ok := sc.C.Targets["tsm2.example.com"]; !ok {
+		t.Errorf("Target tsm2.example.com not kept after failed reload")
+	}
+}
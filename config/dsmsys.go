@@ -0,0 +1,175 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultDsmSysPath = "/opt/tivoli/tsm/client/ba/bin/dsm.sys"
+
+	dsmSysServername = "SErvername"
+	dsmSysTCPAddress = "TCPServeraddress"
+	dsmSysTCPPort    = "TCPPort"
+)
+
+// DsmSysConfig defines how the dsm.sys client system options file is used
+type DsmSysConfig struct {
+	Path     string  `yaml:"path"`
+	Discover bool    `yaml:"discover"`
+	Validate bool    `yaml:"validate"`
+	Defaults *Target `yaml:"defaults,omitempty"`
+}
+
+// DsmSysServer is a SErvername stanza of dsm.sys
+type DsmSysServer struct {
+	Name    string
+	Address string
+	Port    string
+}
+
+// dsmSysOption checks if word is the option, case insensitive and abbreviated
+// to no less than the option's leading upper case letters
+func dsmSysOption(word string, option string) bool {
+	minimum := strings.IndexFunc(option, unicode.IsLower)
+	if minimum == -1 {
+		minimum = len(option)
+	}
+	return len(word) >= minimum && len(word) <= len(option) && strings.EqualFold(word, option[:len(word)])
+}
+
+func parseDsmSys(path string) ([]*DsmSysServer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var servers []*DsmSysServer
+	var server *DsmSysServer
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "*") || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		option := fields[0]
+		value := strings.Trim(strings.TrimSpace(strings.TrimPrefix(text, option)), `"'`)
+		switch {
+		case dsmSysOption(option, dsmSysServername):
+			if value == "" {
+				return nil, fmt.Errorf("line %d: %s has no value", line, dsmSysServername)
+			}
+			server = &DsmSysServer{Name: value}
+			servers = append(servers, server)
+		case server == nil:
+			// Options before the first stanza apply to all servers
+		case dsmSysOption(option, dsmSysTCPAddress):
+			server.Address = value
+		case dsmSysOption(option, dsmSysTCPPort):
+			server.Port = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return servers, nil
+}
+
+// loadDsmSys parses dsm.sys and adds a target for each stanza without one when discover is enabled.
+// Discovered targets use the settings of the first target pattern matching the stanza name, otherwise the defaults,
+// stanzas matching no pattern are skipped when there are no defaults.
+func (c *Config) loadDsmSys() error {
+	if c.DsmSys == nil {
+		return nil
+	}
+	if c.DsmSys.Path == "" {
+		c.DsmSys.Path = defaultDsmSysPath
+	}
+	servers, err := parseDsmSys(c.DsmSys.Path)
+	if err != nil {
+		return fmt.Errorf("Error reading dsm.sys %s: %s", c.DsmSys.Path, err)
+	}
+	c.dsmSysServers = make(map[string]*DsmSysServer)
+	for _, server := range servers {
+		c.dsmSysServers[strings.ToUpper(server.Name)] = server
+	}
+	if !c.DsmSys.Discover {
+		return nil
+	}
+	if c.Targets == nil {
+		c.Targets = make(map[string]*Target)
+	}
+	defined := make(map[string]bool)
+	for key, target := range c.Targets {
+		defined[strings.ToUpper(key)] = true
+		if target.Servername != "" {
+			defined[strings.ToUpper(target.Servername)] = true
+		}
+	}
+	patterns, err := c.targetPatterns()
+	if err != nil {
+		return err
+	}
+	for _, server := range servers {
+		if defined[strings.ToUpper(server.Name)] {
+			continue
+		}
+		var target *Target
+		for _, p := range patterns {
+			if p.match(server.Name) {
+				target = p.target.clone()
+				break
+			}
+		}
+		if target == nil && c.DsmSys.Defaults != nil {
+			target = c.DsmSys.Defaults.clone()
+		}
+		if target == nil {
+			continue
+		}
+		c.Targets[server.Name] = target
+	}
+	return nil
+}
+
+// inDsmSys checks if servername has a stanza in dsm.sys, always true unless validation is enabled
+func (c *Config) inDsmSys(servername string) bool {
+	if c.DsmSys == nil || !c.DsmSys.Validate {
+		return true
+	}
+	_, ok := c.dsmSysServers[strings.ToUpper(servername)]
+	return ok
+}
+
+func (c *Config) updateDsmSysInfo() {
+	dsmSysInfo.Reset()
+	names := make([]string, 0, len(c.dsmSysServers))
+	for name := range c.dsmSysServers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		server := c.dsmSysServers[name]
+		dsmSysInfo.WithLabelValues(server.Name, server.Address, server.Port).Set(1)
+	}
+}
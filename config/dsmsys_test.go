@@ -0,0 +1,127 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseDsmSys(t *testing.T) {
+	servers, err := parseDsmSys("testdata/dsm.sys")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := []*DsmSysServer{
+		{Name: "TSM1", Address: "tsm1.example.com", Port: "1500"},
+		{Name: "tsm2", Address: "10.0.0.2", Port: "1600"},
+		{Name: "TSM3.EXAMPLE.COM", Address: "tsm3.example.com"},
+	}
+	if !reflect.DeepEqual(servers, expected) {
+		for _, s := range servers {
+			t.Logf("%+v", s)
+		}
+		t.Errorf("Unexpected servers")
+	}
+}
+
+func TestDsmSysOption(t *testing.T) {
+	tests := []struct {
+		word   string
+		option string
+		match  bool
+	}{
+		{"SErvername", dsmSysServername, true},
+		{"se", dsmSysServername, true},
+		{"SERV", dsmSysServername, true},
+		{"s", dsmSysServername, false},
+		{"servernames", dsmSysServername, false},
+		{"tcps", dsmSysTCPAddress, true},
+		{"tcp", dsmSysTCPAddress, false},
+		{"TCPPORT", dsmSysTCPPort, true},
+		{"tcpserveraddress", dsmSysTCPPort, false},
+	}
+	for _, test := range tests {
+		if match := dsmSysOption(test.word, test.option); match != test.match {
+			t.Errorf("Unexpected match %v for %s %s", match, test.word, test.option)
+		}
+	}
+}
+
+func TestReloadConfigDsmSys(t *testing.T) {
+	sc := &SafeConfig{}
+	if err := sc.ReloadConfig("testdata/dsm-sys.yaml"); err != nil {
+		t.Fatalf("Unexpected err: %s", err.Error())
+	}
+	if len(sc.C.Targets) != 3 {
+		t.Errorf("Unexpected targets %v", sc.C.Targets)
+	}
+	for _, name := range []string{"tsm2", "TSM3.EXAMPLE.COM"} {
+		target, ok := sc.C.Targets[name]
+		if !ok {
+			t.Errorf("Target %s not discovered", name)
+			continue
+		}
+		if target.Servername != name || target.Id != "somwell" || !reflect.DeepEqual(target.Collectors, []string{"status"}) {
+			t.Errorf("Unexpected target %s: servername=%s id=%s collectors=%v", name, target.Servername, target.Id, target.Collectors)
+		}
+	}
+	if _, ok := sc.Target("tsm3.example.org"); ok {
+		t.Errorf("Pattern should not match a name missing from dsm.sys")
+	}
+	expected := `
+	# HELP tsm_exporter_dsm_sys_info Server stanzas of dsm.sys with their address and port.
+	# TYPE tsm_exporter_dsm_sys_info gauge
+	tsm_exporter_dsm_sys_info{address="tsm3.example.com",port="",servername="TSM3.EXAMPLE.COM"} 1
+	tsm_exporter_dsm_sys_info{address="10.0.0.2",port="1600",servername="tsm2"} 1
+	tsm_exporter_dsm_sys_info{address="tsm1.example.com",port="1500",servername="TSM1"} 1
+	`
+	if err := testutil.CollectAndCompare(dsmSysInfo, strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestReloadConfigDsmSysPatterns(t *testing.T) {
+	sc := &SafeConfig{}
+	if err := sc.ReloadConfig("testdata/dsm-sys-patterns.yaml"); err != nil {
+		t.Fatalf("Unexpected err: %s", err.Error())
+	}
+	if len(sc.C.Targets) != 2 {
+		t.Errorf("Unexpected targets %v", sc.C.Targets)
+	}
+	target, ok := sc.C.Targets["tsm2"]
+	if !ok {
+		t.Fatalf("Target tsm2 not discovered")
+	}
+	if target.Servername != "tsm2" || target.Id != "pattern" || !reflect.DeepEqual(target.Collectors, []string{"volumes"}) {
+		t.Errorf("Unexpected target tsm2: servername=%s id=%s collectors=%v", target.Servername, target.Id, target.Collectors)
+	}
+	if _, ok := sc.C.Targets["TSM3.EXAMPLE.COM"]; ok {
+		t.Errorf("Server matching no pattern should not be discovered without defaults")
+	}
+}
+
+func TestReloadConfigDsmSysInvalid(t *testing.T) {
+	sc := &SafeConfig{}
+	err := sc.ReloadConfig("testdata/dsm-sys-invalid.yaml")
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	if err.Error() != "Target tsm4.example.com servername tsm4.example.com is not defined in dsm.sys testdata/dsm.sys" {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
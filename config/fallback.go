@@ -0,0 +1,45 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// resolveFallback merges the global fallback maximum staleness values with the target's values, the target's take precedence
+func (t *Target) resolveFallback(global map[string]string) error {
+	values := make(map[string]string)
+	for collector, value := range global {
+		values[collector] = value
+	}
+	for collector, value := range t.Fallback {
+		values[collector] = value
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	t.FallbackMaxStale = make(map[string]time.Duration)
+	for collector, value := range values {
+		maxStale, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("Target %s has invalid 'fallback' value '%s' for collector %s: %s", t.Name, value, collector, err)
+		}
+		if maxStale <= 0 {
+			return fmt.Errorf("Target %s has invalid 'fallback' value '%s' for collector %s: must be greater than 0", t.Name, value, collector)
+		}
+		t.FallbackMaxStale[collector] = maxStale
+	}
+	return nil
+}
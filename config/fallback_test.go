@@ -0,0 +1,70 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReloadConfigFallback(t *testing.T) {
+	sc := &SafeConfig{}
+	if err := sc.ReloadConfig("testdata/fallback.yaml"); err != nil {
+		t.Fatalf("Unexpected err: %s", err.Error())
+	}
+	tsm1 := sc.C.Targets["tsm1.example.com"].FallbackMaxStale
+	if tsm1["occupancy"] != 2*time.Hour {
+		t.Errorf("Unexpected occupancy fallback %s", tsm1["occupancy"])
+	}
+	if tsm1["volumes"] != time.Hour {
+		t.Errorf("Unexpected volumes fallback %s", tsm1["volumes"])
+	}
+	tsm2 := sc.C.Targets["tsm2.example.com"].FallbackMaxStale
+	if tsm2["occupancy"] != 24*time.Hour {
+		t.Errorf("Unexpected occupancy fallback %s", tsm2["occupancy"])
+	}
+	if _, ok := tsm2["status"]; ok {
+		t.Errorf("Fallback should not be enabled for status")
+	}
+}
+
+func TestReloadConfigFallbackInvalid(t *testing.T) {
+	sc := &SafeConfig{}
+	err := sc.ReloadConfig("testdata/fallback-invalid.yaml")
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	if !strings.HasPrefix(err.Error(), "Target tsm1.example.com has invalid 'fallback' value 'forever' for collector occupancy") {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestReloadConfigFallbackUnknown(t *testing.T) {
+	sc := &SafeConfig{}
+	err := sc.ReloadConfig("testdata/fallback-unknown.yaml")
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	if err.Error() != "Target tsm1.example.com has unknown collector ocupancy in 'fallback'" {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestResolveFallbackNegative(t *testing.T) {
+	target := &Target{Name: "tsm1", Fallback: map[string]string{"db": "-1h"}}
+	if err := target.resolveFallback(nil); err == nil {
+		t.Errorf("Expected error")
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+func (t *Target) validateLabels() error {
+	for name := range t.Labels {
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			return fmt.Errorf("Target %s has invalid label name %s", t.Name, name)
+		}
+	}
+	return nil
+}
+
+// DiscoveryLabels returns the labels of the target used for service discovery,
+// the target's metadata followed by the user defined labels which take precedence
+func (t *Target) DiscoveryLabels() map[string]string {
+	labels := make(map[string]string)
+	metadata := map[string]string{
+		"servername":   t.Servername,
+		"library_name": t.LibraryName,
+		"timezone":     t.Timezone,
+	}
+	for name, value := range metadata {
+		if value != "" {
+			labels[name] = value
+		}
+	}
+	for name, value := range t.Labels {
+		labels[name] = value
+	}
+	return labels
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiscoveryLabels(t *testing.T) {
+	target := &Target{
+		Name:        "tsm1.example.com",
+		Servername:  "tsm1",
+		LibraryName: "LIB1",
+		Labels:      map[string]string{"env": "prod", "library_name": "LIB2"},
+	}
+	expected := map[string]string{"servername": "tsm1", "library_name": "LIB2", "env": "prod"}
+	if labels := target.DiscoveryLabels(); !reflect.DeepEqual(labels, expected) {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	for _, name := range []string{"__address__", "1env", "env-name"} {
+		target := &Target{Name: "tsm1.example.com", Labels: map[string]string{name: "prod"}}
+		if err := target.validateLabels(); err == nil {
+			t.Errorf("Expected error for label %s", name)
+		} else if err.Error() != "Target tsm1.example.com has invalid label name "+name {
+			t.Errorf("Unexpected error: %s", err)
+		}
+	}
+	target := &Target{Name: "tsm1.example.com", Labels: map[string]string{"env": "prod"}}
+	if err := target.validateLabels(); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+)
+
+// Module is a reusable bundle of collectors and collector options.
+// Values defined by a target take precedence over the values of its module,
+// except for the collectors and collector options of a module selected at scrape time.
+type Module struct {
+	Collectors           []string                     `yaml:"collectors,omitempty"`
+	LibraryName          string                       `yaml:"library_name"`
+	Schedules            []string                     `yaml:"schedules"`
+	ReplicationNodeNames []string                     `yaml:"replication_node_names"`
+	VolumeUsageMap       map[string]string            `yaml:"volumeusage_map,omitempty"`
+	SummaryActivities    []string                     `yaml:"summary_activities,omitempty"`
+	CollectorOptions     map[string]*CollectorOptions `yaml:"collector_options,omitempty"`
+}
+
+// Auth is a reusable set of credentials.
+// The id and login defined by a target take precedence, the password sources are only used if the target defines none.
+type Auth struct {
+	Id              string `yaml:"id"`
+	Password        string `yaml:"password"`
+	PasswordFile    string `yaml:"password_file"`
+	PasswordEnv     string `yaml:"password_env"`
+	PasswordCommand string `yaml:"password_command"`
+	Login           string `yaml:"login"`
+}
+
+func (t *Target) applyAuth(auth map[string]*Auth) error {
+	if t.AuthProfile == "" {
+		return nil
+	}
+	a, ok := auth[t.AuthProfile]
+	if !ok {
+		return fmt.Errorf("Target %s references undefined auth profile %s", t.Name, t.AuthProfile)
+	}
+	if t.Id == "" {
+		t.Id = a.Id
+	}
+	if t.Login == "" {
+		t.Login = a.Login
+	}
+	if t.Password == "" && t.PasswordFile == "" && t.PasswordEnv == "" && t.PasswordCommand == "" {
+		t.Password = a.Password
+		t.PasswordFile = a.PasswordFile
+		t.PasswordEnv = a.PasswordEnv
+		t.PasswordCommand = a.PasswordCommand
+	}
+	return nil
+}
+
+func (t *Target) resolveModule(modules map[string]*Module) error {
+	t.own = Module{
+		Collectors:           t.Collectors,
+		LibraryName:          t.LibraryName,
+		Schedules:            t.Schedules,
+		ReplicationNodeNames: t.ReplicationNodeNames,
+		VolumeUsageMap:       t.VolumeUsageMap,
+		SummaryActivities:    t.SummaryActivities,
+		CollectorOptions:     t.CollectorOptions,
+	}
+	if t.Module == "" {
+		return nil
+	}
+	m, ok := modules[t.Module]
+	if !ok {
+		return fmt.Errorf("Target %s references undefined module %s", t.Name, t.Module)
+	}
+	t.applyModule(m, false)
+	return nil
+}
+
+// applyModule sets the values the target does not define from the module.
+// A module selected at scrape time overrides the target's collectors and collector_options.
+func (t *Target) applyModule(m *Module, selected bool) {
+	t.Collectors = t.own.Collectors
+	if t.Collectors == nil || (selected && m.Collectors != nil) {
+		t.Collectors = m.Collectors
+	}
+	t.LibraryName = t.own.LibraryName
+	if t.LibraryName == "" {
+		t.LibraryName = m.LibraryName
+	}
+	t.Schedules = t.own.Schedules
+	if t.Schedules == nil {
+		t.Schedules = m.Schedules
+	}
+	t.ReplicationNodeNames = t.own.ReplicationNodeNames
+	if t.ReplicationNodeNames == nil {
+		t.ReplicationNodeNames = m.ReplicationNodeNames
+	}
+	t.VolumeUsageMap = t.own.VolumeUsageMap
+	if t.VolumeUsageMap == nil {
+		t.VolumeUsageMap = m.VolumeUsageMap
+	}
+	t.SummaryActivities = t.own.SummaryActivities
+	if t.SummaryActivities == nil {
+		t.SummaryActivities = m.SummaryActivities
+	}
+	t.CollectorOptions = t.own.CollectorOptions
+	if m.CollectorOptions != nil {
+		t.CollectorOptions = make(map[string]*CollectorOptions)
+		for collector, o := range m.CollectorOptions {
+			t.CollectorOptions[collector] = o
+		}
+		for collector, o := range t.own.CollectorOptions {
+			if selected {
+				t.CollectorOptions[collector] = m.CollectorOptions[collector].merge(o)
+			} else {
+				t.CollectorOptions[collector] = o.merge(m.CollectorOptions[collector])
+			}
+		}
+	}
+}
+
+// WithModule returns a copy of the target using the given module selected at scrape time instead of the target's module.
+func (t *Target) WithModule(name string, m *Module) *Target {
+	c := t.clone()
+	c.Module = name
+	c.applyModule(m, true)
+	c.base = t.Base()
+	return c
+}
+
+// Base returns the target a module copy was made from, or the target itself.
+// Module copies only change collectors and their options so they share the connections of their base target.
+func (t *Target) Base() *Target {
+	if t.base != nil {
+		return t.base
+	}
+	return t
+}
+
+func moduleTargetKey(target string, module string) string {
+	return target + "/" + module
+}
+
+// ModuleTarget returns the copy of target using the named module, which must be defined.
+// Copies are kept with the configuration so that every scrape of a target and module uses the same target.
+func (c *Config) ModuleTarget(target *Target, name string) *Target {
+	key := moduleTargetKey(target.Name, name)
+	c.resolvedLock.Lock()
+	defer c.resolvedLock.Unlock()
+	if t, ok := c.moduleTargets[key]; ok && t.base == target {
+		return t
+	}
+	if c.moduleTargets == nil {
+		c.moduleTargets = make(map[string]*Target)
+	}
+	t := target.WithModule(name, c.Modules[name])
+	c.moduleTargets[key] = t
+	return t
+}
+
+// resolveModuleTargets creates the module copies of the defined targets
+func (c *Config) resolveModuleTargets() {
+	c.moduleTargets = make(map[string]*Target)
+	for name, target := range c.Targets {
+		for module, m := range c.Modules {
+			c.moduleTargets[moduleTargetKey(name, module)] = target.WithModule(module, m)
+		}
+	}
+}
+
+func (t *Target) clone() *Target {
+	c := *t
+	return &c
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestReloadConfigModules(t *testing.T) {
+	os.Setenv("TSM2_PASSWORD", "secret2")
+	defer os.Unsetenv("TSM2_PASSWORD")
+	sc := &SafeConfig{}
+	if err := sc.ReloadConfig("testdata/modules.yaml"); err != nil {
+		t.Fatalf("Unexpected err: %s", err.Error())
+	}
+	tsm1 := sc.C.Targets["tsm1.example.com"]
+	if tsm1.Id != "somwell" || tsm1.Password != "secret" || tsm1.Login != LoginPty {
+		t.Errorf("Unexpected credentials id=%s password=%s login=%s", tsm1.Id, tsm1.Password, tsm1.Login)
+	}
+	if !reflect.DeepEqual(tsm1.Collectors, []string{"status", "volumes"}) {
+		t.Errorf("Unexpected collectors %v", tsm1.Collectors)
+	}
+	if tsm1.LibraryName != "LIB2" {
+		t.Errorf("Unexpected library_name %s", tsm1.LibraryName)
+	}
+	if !reflect.DeepEqual(tsm1.Schedules, []string{"DB1"}) {
+		t.Errorf("Unexpected schedules %v", tsm1.Schedules)
+	}
+	tsm2 := sc.C.Targets["tsm2.example.com"]
+	if tsm2.Id != "other" || tsm2.Password != "secret2" || tsm2.Login != LoginArgv {
+		t.Errorf("Unexpected credentials id=%s password=%s login=%s", tsm2.Id, tsm2.Password, tsm2.Login)
+	}
+	if tsm2.Collectors != nil {
+		t.Errorf("Unexpected collectors %v", tsm2.Collectors)
+	}
+}
+
+func TestTargetWithModule(t *testing.T) {
+	os.Setenv("TSM2_PASSWORD", "secret2")
+	defer os.Unsetenv("TSM2_PASSWORD")
+	sc := &SafeConfig{}
+	if err := sc.ReloadConfig("testdata/modules.yaml"); err != nil {
+		t.Fatalf("Unexpected err: %s", err.Error())
+	}
+	tsm1 := sc.C.Targets["tsm1.example.com"]
+	nightly := tsm1.WithModule("nightly", sc.C.Modules["nightly"])
+	if nightly == tsm1 || nightly.Name != tsm1.Name || nightly.Password != "secret" {
+		t.Errorf("Unexpected target %v", nightly)
+	}
+	if !reflect.DeepEqual(nightly.Collectors, []string{"occupancy", "volumeusage"}) {
+		t.Errorf("Unexpected collectors %v", nightly.Collectors)
+	}
+	if nightly.LibraryName != "LIB2" {
+		t.Errorf("Unexpected library_name %s", nightly.LibraryName)
+	}
+	if nightly.Schedules != nil {
+		t.Errorf("Unexpected schedules %v", nightly.Schedules)
+	}
+	if nightly.VolumeUsageMap["LTO6"] != "^E.*" {
+		t.Errorf("Unexpected volumeusage_map %v", nightly.VolumeUsageMap)
+	}
+	if !reflect.DeepEqual(tsm1.Collectors, []string{"status", "volumes"}) {
+		t.Errorf("Original target modified, collectors %v", tsm1.Collectors)
+	}
+}
+
+func TestTargetWithModuleOverridesCollectors(t *testing.T) {
+	os.Setenv("TSM2_PASSWORD", "secret2")
+	defer os.Unsetenv("TSM2_PASSWORD")
+	sc := &SafeConfig{}
+	if err := sc.ReloadConfig("testdata/modules.yaml"); err != nil {
+		t.Fatalf("Unexpected err: %s", err.Error())
+	}
+	tsm3 := sc.C.Targets["tsm3.example.com"]
+	nightly := tsm3.WithModule("nightly", sc.C.Modules["nightly"])
+	if !reflect.DeepEqual(nightly.Collectors, []string{"occupancy", "volumeusage"}) {
+		t.Errorf("Unexpected collectors %v", nightly.Collectors)
+	}
+	if timeout := nightly.Options("occupancy").Timeout; timeout != 600 {
+		t.Errorf("Unexpected occupancy timeout %d", timeout)
+	}
+	daily := tsm3.WithModule("daily", sc.C.Modules["daily"])
+	if timeout := daily.Options("occupancy").Timeout; timeout != 30 {
+		t.Errorf("Unexpected occupancy timeout %d", timeout)
+	}
+	if !reflect.DeepEqual(tsm3.Collectors, []string{"status"}) {
+		t.Errorf("Original target modified, collectors %v", tsm3.Collectors)
+	}
+}
+
+func TestReloadConfigModulesInvalid(t *testing.T) {
+	tests := map[string]string{
+		"testdata/modules-unknown-module.yaml": "Target tsm1.example.com references undefined module dne",
+		"testdata/modules-unknown-auth.yaml":   "Target tsm1.example.com references undefined auth profile dne",
+	}
+	for file, expected := range tests {
+		sc := &SafeConfig{}
+		err := sc.ReloadConfig(file)
+		if err == nil {
+			t.Errorf("Expected error for %s", file)
+		} else if err.Error() != expected {
+			t.Errorf("Unexpected error for %s: %s", file, err)
+		}
+	}
+}
+
+func TestConfigModuleTarget(t *testing.T) {
+	os.Setenv("TSM2_PASSWORD", "secret2")
+	defer os.Unsetenv("TSM2_PASSWORD")
+	sc := &SafeConfig{}
+	if err := sc.ReloadConfig("testdata/modules.yaml"); err != nil {
+		t.Fatalf("Unexpected err: %s", err.Error())
+	}
+	tsm1 := sc.C.Targets["tsm1.example.com"]
+	nightly := sc.C.ModuleTarget(tsm1, "nightly")
+	if !reflect.DeepEqual(nightly.Collectors, []string{"occupancy", "volumeusage"}) {
+		t.Errorf("Unexpected collectors %v", nightly.Collectors)
+	}
+	if again := sc.C.ModuleTarget(tsm1, "nightly"); again != nightly {
+		t.Errorf("Module target was not reused")
+	}
+	if nightly.Base() != tsm1 || tsm1.Base() != tsm1 {
+		t.Errorf("Unexpected base target")
+	}
+}
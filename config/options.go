@@ -0,0 +1,169 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// CollectorOptions are the settings of one collector for a target.
+// Unset values fall back to the target's top level values and then to the command line flags.
+type CollectorOptions struct {
+	Timeout              int               `yaml:"timeout"`
+	LibraryName          string            `yaml:"library_name"`
+	Schedules            []string          `yaml:"schedules"`
+	ReplicationNodeNames []string          `yaml:"replication_node_names"`
+	VolumeUsageMap       map[string]string `yaml:"volumeusage_map,omitempty"`
+	SummaryActivities    []string          `yaml:"summary_activities,omitempty"`
+	ClassnameExclude     string            `yaml:"classname_exclude"`
+	Window               time.Duration     `yaml:"window"`
+}
+
+// collectorOptionSupport lists the collectors supporting each option other than timeout
+var collectorOptionSupport = map[string][]string{
+	"library_name":           {"drives", "libvolumes"},
+	"schedules":              {"events"},
+	"replication_node_names": {"replicationview"},
+	"volumeusage_map":        {"volumeusage"},
+	"summary_activities":     {"summary"},
+	"classname_exclude":      {"volumes"},
+	"window":                 {"events", "summary"},
+}
+
+// Options returns the effective options of a collector, the collector_options values take precedence over the target's top level values
+func (t *Target) Options(collector string) CollectorOptions {
+	var o CollectorOptions
+	if opts := t.CollectorOptions[collector]; opts != nil {
+		o = *opts
+	}
+	if o.LibraryName == "" {
+		o.LibraryName = t.LibraryName
+	}
+	if o.Schedules == nil {
+		o.Schedules = t.Schedules
+	}
+	if o.ReplicationNodeNames == nil {
+		o.ReplicationNodeNames = t.ReplicationNodeNames
+	}
+	if o.VolumeUsageMap == nil {
+		o.VolumeUsageMap = t.VolumeUsageMap
+	}
+	if o.SummaryActivities == nil {
+		o.SummaryActivities = t.SummaryActivities
+	}
+	return o
+}
+
+// merge returns the options with unset values taken from defaults
+func (o *CollectorOptions) merge(defaults *CollectorOptions) *CollectorOptions {
+	if o == nil {
+		return defaults
+	}
+	if defaults == nil {
+		return o
+	}
+	merged := *o
+	if merged.Timeout == 0 {
+		merged.Timeout = defaults.Timeout
+	}
+	if merged.LibraryName == "" {
+		merged.LibraryName = defaults.LibraryName
+	}
+	if merged.Schedules == nil {
+		merged.Schedules = defaults.Schedules
+	}
+	if merged.ReplicationNodeNames == nil {
+		merged.ReplicationNodeNames = defaults.ReplicationNodeNames
+	}
+	if merged.VolumeUsageMap == nil {
+		merged.VolumeUsageMap = defaults.VolumeUsageMap
+	}
+	if merged.SummaryActivities == nil {
+		merged.SummaryActivities = defaults.SummaryActivities
+	}
+	if merged.ClassnameExclude == "" {
+		merged.ClassnameExclude = defaults.ClassnameExclude
+	}
+	if merged.Window == 0 {
+		merged.Window = defaults.Window
+	}
+	return &merged
+}
+
+func (o *CollectorOptions) setOptions() []string {
+	var options []string
+	if o.LibraryName != "" {
+		options = append(options, "library_name")
+	}
+	if o.Schedules != nil {
+		options = append(options, "schedules")
+	}
+	if o.ReplicationNodeNames != nil {
+		options = append(options, "replication_node_names")
+	}
+	if o.VolumeUsageMap != nil {
+		options = append(options, "volumeusage_map")
+	}
+	if o.SummaryActivities != nil {
+		options = append(options, "summary_activities")
+	}
+	if o.ClassnameExclude != "" {
+		options = append(options, "classname_exclude")
+	}
+	if o.Window != 0 {
+		options = append(options, "window")
+	}
+	return options
+}
+
+// validateCollectorOptions checks the collector_options of owner, such as "Target tsm1" or "Module nightly"
+func (c *Config) validateCollectorOptions(owner string, options map[string]*CollectorOptions) error {
+	collectors := make([]string, 0, len(options))
+	for collector := range options {
+		collectors = append(collectors, collector)
+	}
+	sort.Strings(collectors)
+	for _, collector := range collectors {
+		if !c.isCollector(collector) {
+			return fmt.Errorf("%s collector_options has unknown collector %s", owner, collector)
+		}
+		o := options[collector]
+		if o == nil {
+			continue
+		}
+		for _, option := range o.setOptions() {
+			if !sliceContains(collectorOptionSupport[option], collector) {
+				return fmt.Errorf("%s collector_options for collector %s does not support option '%s'", owner, collector, option)
+			}
+		}
+		if o.Timeout < 0 {
+			return fmt.Errorf("%s collector_options for collector %s has invalid 'timeout' value %d, must not be negative", owner, collector, o.Timeout)
+		}
+		if o.Window < 0 {
+			return fmt.Errorf("%s collector_options for collector %s has invalid 'window' value %s, must not be negative", owner, collector, o.Window)
+		}
+		if _, err := regexp.Compile(o.ClassnameExclude); err != nil {
+			return fmt.Errorf("%s collector_options for collector %s has invalid 'classname_exclude' value: %s", owner, collector, err)
+		}
+		for name, regex := range o.VolumeUsageMap {
+			if _, err := regexp.Compile(regex); err != nil {
+				return fmt.Errorf("%s collector_options for collector %s has invalid 'volumeusage_map' value for %s: %s", owner, collector, name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReloadConfigCollectorOptions(t *testing.T) {
+	sc := &SafeConfig{}
+	if err := sc.ReloadConfig("testdata/collector-options.yaml"); err != nil {
+		t.Fatalf("Unexpected err: %s", err.Error())
+	}
+	target := sc.C.Targets["tsm1.example.com"]
+	drives := target.Options("drives")
+	if drives.Timeout != 30 || drives.LibraryName != "LIB1" {
+		t.Errorf("Unexpected drives options %+v", drives)
+	}
+	libvolumes := target.Options("libvolumes")
+	if libvolumes.Timeout != 0 || libvolumes.LibraryName != "TAPE" {
+		t.Errorf("Unexpected libvolumes options %+v", libvolumes)
+	}
+	events := target.Options("events")
+	if !reflect.DeepEqual(events.Schedules, []string{"DB2"}) || events.Window != 48*time.Hour {
+		t.Errorf("Unexpected events options %+v", events)
+	}
+	if summary := target.Options("summary"); summary.Window != 2*time.Hour {
+		t.Errorf("Unexpected summary options %+v", summary)
+	}
+	if volumes := target.Options("volumes"); volumes.ClassnameExclude != "^DCFILE" {
+		t.Errorf("Unexpected volumes options %+v", volumes)
+	}
+}
+
+func TestReloadConfigCollectorOptionsQuery(t *testing.T) {
+	sc := &SafeConfig{}
+	if err := sc.ReloadConfig("testdata/collector-options-query.yaml"); err != nil {
+		t.Fatalf("Unexpected err: %s", err.Error())
+	}
+	if sessions := sc.C.Targets["tsm1.example.com"].Options("sessions"); sessions.Timeout != 60 {
+		t.Errorf("Unexpected sessions options %+v", sessions)
+	}
+}
+
+func TestReloadConfigCollectorOptionsInvalid(t *testing.T) {
+	tests := map[string]string{
+		"testdata/collector-options-unknown.yaml":       "Target tsm1.example.com collector_options has unknown collector ocupancy",
+		"testdata/collector-options-unsupported.yaml":   "Target tsm1.example.com collector_options for collector db does not support option 'library_name'",
+		"testdata/collector-options-invalid-regex.yaml": "Module tape collector_options for collector volumes has invalid 'classname_exclude' value",
+	}
+	for file, expected := range tests {
+		sc := &SafeConfig{}
+		err := sc.ReloadConfig(file)
+		if err == nil {
+			t.Errorf("Expected error for %s", file)
+		} else if !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("Unexpected error for %s: %s", file, err)
+		}
+	}
+}
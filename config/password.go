@@ -0,0 +1,110 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+var (
+	passwordCommandTimeout = 30 * time.Second
+)
+
+// resolvePassword sets Password from whichever password source the target defines.
+func (t *Target) resolvePassword() error {
+	sources := 0
+	for _, s := range []string{t.Password, t.PasswordFile, t.PasswordEnv, t.PasswordCommand} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources == 0 {
+		return fmt.Errorf("Target %s must define one of 'password', 'password_file', 'password_env' or 'password_command'", t.Name)
+	}
+	if sources > 1 {
+		return fmt.Errorf("Target %s must define only one of 'password', 'password_file', 'password_env' or 'password_command'", t.Name)
+	}
+	var password string
+	var err error
+	switch {
+	case t.Password != "":
+		return nil
+	case t.PasswordFile != "":
+		password, err = readPasswordFile(t.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("Target %s password_file %s: %s", t.Name, t.PasswordFile, err)
+		}
+	case t.PasswordEnv != "":
+		password = os.Getenv(t.PasswordEnv)
+		if password == "" {
+			return fmt.Errorf("Target %s password_env %s: environment variable is not set", t.Name, t.PasswordEnv)
+		}
+	case t.PasswordCommand != "":
+		password, err = runPasswordCommand(t.PasswordCommand)
+		if err != nil {
+			return fmt.Errorf("Target %s password_command: %s", t.Name, err)
+		}
+	}
+	t.Password = password
+	return nil
+}
+
+func readPasswordFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("not a regular file")
+	}
+	if perm := info.Mode().Perm(); perm&0027 != 0 {
+		return "", fmt.Errorf("permissions %#o are too open, must not be writable by group or accessible by others", perm)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	password := strings.TrimRight(string(data), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("file is empty")
+	}
+	return password, nil
+}
+
+func runPasswordCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), passwordCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("timeout after %s", passwordCommandTimeout)
+		}
+		return "", fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	password := strings.TrimRight(stdout.String(), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("command returned empty output")
+	}
+	return password, nil
+}
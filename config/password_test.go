@@ -0,0 +1,107 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, target string) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tsm_exporter.yaml")
+	content := fmt.Sprintf("targets:\n  tsm1.example.com:\n    id: somwell\n%s", target)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writePasswordFile(t *testing.T, mode os.FileMode) string {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("secret\n"), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReloadConfigPasswordSources(t *testing.T) {
+	t.Setenv("TSM_EXPORTER_TEST_PASSWORD", "secret")
+	tests := []string{
+		"    password: secret\n",
+		fmt.Sprintf("    password_file: %s\n", writePasswordFile(t, 0600)),
+		"    password_env: TSM_EXPORTER_TEST_PASSWORD\n",
+		"    password_command: echo secret\n",
+	}
+	for i, test := range tests {
+		sc := &SafeConfig{}
+		if err := sc.ReloadConfig(writeConfig(t, test)); err != nil {
+			t.Errorf("Unexpected error in case %d: %s", i, err)
+			continue
+		}
+		if password := sc.C.Targets["tsm1.example.com"].Password; password != "secret" {
+			t.Errorf("Unexpected password in case %d: %s", i, password)
+		}
+	}
+}
+
+func TestReloadConfigPasswordSourceErrors(t *testing.T) {
+	os.Unsetenv("TSM_EXPORTER_TEST_MISSING")
+	tests := []struct {
+		Target        string
+		ExpectedError string
+	}{
+		{
+			Target:        "    password: secret\n    password_env: FOO\n",
+			ExpectedError: "Target tsm1.example.com must define only one of 'password', 'password_file', 'password_env' or 'password_command'",
+		},
+		{
+			Target:        "    password_file: /dne\n",
+			ExpectedError: "Target tsm1.example.com password_file /dne: stat /dne: no such file or directory",
+		},
+		{
+			Target:        fmt.Sprintf("    password_file: %s\n", writePasswordFile(t, 0644)),
+			ExpectedError: "permissions 0644 are too open, must not be writable by group or accessible by others",
+		},
+		{
+			Target:        "    password_env: TSM_EXPORTER_TEST_MISSING\n",
+			ExpectedError: "Target tsm1.example.com password_env TSM_EXPORTER_TEST_MISSING: environment variable is not set",
+		},
+		{
+			Target:        "    password_command: echo failed >&2; exit 1\n",
+			ExpectedError: "Target tsm1.example.com password_command: exit status 1: failed",
+		},
+		{
+			Target:        "    password_command: 'true'\n",
+			ExpectedError: "Target tsm1.example.com password_command: command returned empty output",
+		},
+	}
+	for i, test := range tests {
+		sc := &SafeConfig{}
+		err := sc.ReloadConfig(writeConfig(t, test.Target))
+		if err == nil {
+			t.Errorf("In case %v:\nExpected:\n%v\nGot:\nnil", i, test.ExpectedError)
+			continue
+		}
+		if !strings.HasSuffix(err.Error(), test.ExpectedError) {
+			t.Errorf("In case %v:\nExpected:\n%v\nGot:\n%v", i, test.ExpectedError, err.Error())
+		}
+	}
+}
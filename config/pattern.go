@@ -0,0 +1,167 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"container/list"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// maxResolvedTargets limits the cache of targets resolved from patterns, the least recently used target is evicted
+	// so that scrapes of arbitrary names matching a pattern can not grow memory without limit
+	maxResolvedTargets = 1000
+)
+
+// targetPattern is a target whose key is a glob, or a regexp when prefixed with '~',
+// it supplies the settings of any target name it matches
+type targetPattern struct {
+	key    string
+	regexp *regexp.Regexp
+	target *Target
+}
+
+func isTargetPattern(key string) bool {
+	return strings.HasPrefix(key, "~") || strings.ContainsAny(key, "*?[")
+}
+
+func newTargetPattern(key string, target *Target) (*targetPattern, error) {
+	p := &targetPattern{key: key, target: target}
+	if strings.HasPrefix(key, "~") {
+		re, err := regexp.Compile("^(?:" + strings.TrimPrefix(key, "~") + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("Target %s has invalid regexp: %s", key, err)
+		}
+		p.regexp = re
+	} else if _, err := path.Match(key, ""); err != nil {
+		return nil, fmt.Errorf("Target %s has invalid glob: %s", key, err)
+	}
+	return p, nil
+}
+
+func (p *targetPattern) match(name string) bool {
+	if p.regexp != nil {
+		return p.regexp.MatchString(name)
+	}
+	match, _ := path.Match(p.key, name)
+	return match
+}
+
+// targetPatterns returns the target patterns of Targets, longer patterns are matched first
+func (c *Config) targetPatterns() ([]*targetPattern, error) {
+	var patterns []*targetPattern
+	for key, target := range c.Targets {
+		if !isTargetPattern(key) {
+			continue
+		}
+		p, err := newTargetPattern(key, target)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i].key) != len(patterns[j].key) {
+			return len(patterns[i].key) > len(patterns[j].key)
+		}
+		return patterns[i].key < patterns[j].key
+	})
+	return patterns, nil
+}
+
+// splitPatterns moves the target patterns out of Targets
+func (c *Config) splitPatterns() error {
+	patterns, err := c.targetPatterns()
+	if err != nil {
+		return err
+	}
+	for _, p := range patterns {
+		delete(c.Targets, p.key)
+	}
+	c.patterns = patterns
+	c.resolved = make(map[string]*list.Element)
+	c.resolvedOrder = list.New()
+	return nil
+}
+
+// Target returns the target defined for name or the target resolved from the first target pattern matching name.
+// Resolved targets are cached so that scrapes of the same name use the same target and its backend connections.
+func (c *Config) Target(name string) (*Target, bool) {
+	if target, ok := c.Targets[name]; ok {
+		return target, true
+	}
+	c.resolvedLock.Lock()
+	defer c.resolvedLock.Unlock()
+	if e, ok := c.resolved[name]; ok {
+		c.resolvedOrder.MoveToFront(e)
+		return e.Value.(*Target), true
+	}
+	for _, p := range c.patterns {
+		if !p.match(name) {
+			continue
+		}
+		if p.target.Backend == BackendDsmadmc && !c.inDsmSys(name) {
+			continue
+		}
+		target := p.target.clone()
+		target.Name = name
+		target.Servername = name
+		c.resolved[name] = c.resolvedOrder.PushFront(target)
+		if c.resolvedOrder.Len() > maxResolvedTargets {
+			c.evictResolved()
+		}
+		return target, true
+	}
+	return nil, false
+}
+
+// TargetNames returns the names of the defined targets and the targets resolved from target patterns
+func (c *Config) TargetNames() []string {
+	var names []string
+	for name := range c.Targets {
+		names = append(names, name)
+	}
+	c.resolvedLock.Lock()
+	defer c.resolvedLock.Unlock()
+	for name := range c.resolved {
+		names = append(names, name)
+	}
+	return names
+}
+
+// evictResolved removes the least recently used resolved target and its module copies
+func (c *Config) evictResolved() {
+	e := c.resolvedOrder.Back()
+	c.resolvedOrder.Remove(e)
+	target := e.Value.(*Target)
+	delete(c.resolved, target.Name)
+	for module := range c.Modules {
+		delete(c.moduleTargets, moduleTargetKey(target.Name, module))
+	}
+	if c.evicted != nil {
+		c.evicted(target.Name)
+	}
+}
+
+// Target returns the target for name from the current configuration
+func (sc *SafeConfig) Target(name string) (*Target, bool) {
+	sc.RLock()
+	c := sc.C
+	sc.RUnlock()
+	return c.Target(name)
+}
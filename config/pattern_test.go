@@ -0,0 +1,113 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestReloadConfigPatterns(t *testing.T) {
+	sc := &SafeConfig{}
+	if err := sc.ReloadConfig("testdata/patterns.yaml"); err != nil {
+		t.Fatalf("Unexpected err: %s", err.Error())
+	}
+	if len(sc.C.Targets) != 1 {
+		t.Errorf("Unexpected targets %v", sc.C.Targets)
+	}
+	tests := map[string]string{
+		"tsm1.example.com":     "exact",
+		"tsm2.example.com":     "glob",
+		"tsm41.example.com":    "longer",
+		"backup12.example.com": "regexp",
+	}
+	for name, id := range tests {
+		target, ok := sc.Target(name)
+		if !ok {
+			t.Errorf("Target %s not found", name)
+			continue
+		}
+		if target.Id != id || target.Name != name || target.Servername != name {
+			t.Errorf("Unexpected target for %s: id=%s name=%s servername=%s", name, target.Id, target.Name, target.Servername)
+		}
+	}
+	for _, name := range []string{"tsm2.example.org", "backup.example.com", "xbackup1.example.com"} {
+		if _, ok := sc.Target(name); ok {
+			t.Errorf("Target %s should not match", name)
+		}
+	}
+	first, _ := sc.Target("tsm2.example.com")
+	second, _ := sc.Target("tsm2.example.com")
+	if first != second {
+		t.Errorf("Resolved target is not cached")
+	}
+	if first.Collectors[0] != "status" {
+		t.Errorf("Unexpected collectors %v", first.Collectors)
+	}
+}
+
+func TestReloadConfigPatternsInvalid(t *testing.T) {
+	tests := map[string]string{
+		"testdata/patterns-servername.yaml":     "Target tsm*.example.com is a pattern and can not define 'servername'",
+		"testdata/patterns-invalid-regexp.yaml": "Target ~tsm(.example.com has invalid regexp",
+	}
+	for file, expected := range tests {
+		sc := &SafeConfig{}
+		err := sc.ReloadConfig(file)
+		if err == nil {
+			t.Errorf("Expected error for %s", file)
+		} else if !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("Unexpected error for %s: %s", file, err)
+		}
+	}
+}
+
+func TestConfigTargetEvicted(t *testing.T) {
+	defer func(max int) { maxResolvedTargets = max }(maxResolvedTargets)
+	maxResolvedTargets = 2
+	var evicted []string
+	sc := &SafeConfig{Evicted: func(name string) { evicted = append(evicted, name) }}
+	if err := sc.ReloadConfig("testdata/patterns.yaml"); err != nil {
+		t.Fatalf("Unexpected err: %s", err.Error())
+	}
+	first, _ := sc.Target("tsm2.example.com")
+	_, _ = sc.Target("tsm3.example.com")
+	// Using a resolved target keeps it in the cache
+	_, _ = sc.Target("tsm2.example.com")
+	_, _ = sc.Target("tsm4.example.com")
+	if len(sc.C.resolved) != 2 {
+		t.Errorf("Unexpected number of resolved targets %d", len(sc.C.resolved))
+	}
+	if len(evicted) != 1 || evicted[0] != "tsm3.example.com" {
+		t.Errorf("Unexpected evicted targets %v", evicted)
+	}
+	if again, _ := sc.Target("tsm2.example.com"); again != first {
+		t.Errorf("Recently used target was evicted")
+	}
+}
+
+func TestConfigTargetNames(t *testing.T) {
+	sc := &SafeConfig{}
+	if err := sc.ReloadConfig("testdata/patterns.yaml"); err != nil {
+		t.Fatalf("Unexpected err: %s", err.Error())
+	}
+	_, _ = sc.Target("tsm2.example.com")
+	names := sc.C.TargetNames()
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"tsm1.example.com", "tsm2.example.com"}) {
+		t.Errorf("Unexpected target names %v", names)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	ValueGauge          = "gauge"
+	ValueCounter        = "counter"
+	ValueTimestamp      = "timestamp"
+	ValueMBToBytes      = "mb_to_bytes"
+	ValuePercentToRatio = "percent_to_ratio"
+
+	defaultQueryTimeout = 10
+)
+
+var (
+	metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	valueTypes       = []string{ValueGauge, ValueCounter, ValueTimestamp, ValueMBToBytes, ValuePercentToRatio}
+)
+
+// Query is a user defined SQL query whose columns are exposed as metrics
+type Query struct {
+	Name    string         `yaml:"name"`
+	Query   string         `yaml:"query"`
+	Columns []string       `yaml:"columns"`
+	Labels  []string       `yaml:"labels"`
+	Values  []*QueryValue  `yaml:"values"`
+	Targets []string       `yaml:"targets,omitempty"`
+	Timeout int            `yaml:"timeout"`
+	columns map[string]int `yaml:"-"`
+}
+
+type QueryValue struct {
+	Column string `yaml:"column"`
+	Metric string `yaml:"metric"`
+	Help   string `yaml:"help"`
+	Type   string `yaml:"type"`
+}
+
+// ColumnIndex returns the position of a column in the query output
+func (q *Query) ColumnIndex(column string) int {
+	return q.columns[column]
+}
+
+func (q *Query) validate(targets map[string]*Target) error {
+	if q.Name == "" || !metricNameRegexp.MatchString(q.Name) {
+		return fmt.Errorf("Query '%s' must define a 'name' value made of letters, digits and underscores", q.Name)
+	}
+	if IsCollector(q.Name) {
+		return fmt.Errorf("Query %s has the same name as a collector", q.Name)
+	}
+	if q.Query == "" {
+		return fmt.Errorf("Query %s must define 'query' value", q.Name)
+	}
+	if len(q.Columns) == 0 {
+		return fmt.Errorf("Query %s must define 'columns' value", q.Name)
+	}
+	if len(q.Values) == 0 {
+		return fmt.Errorf("Query %s must define at least one 'values' entry", q.Name)
+	}
+	if q.Timeout == 0 {
+		q.Timeout = defaultQueryTimeout
+	}
+	q.columns = make(map[string]int)
+	for i, column := range q.Columns {
+		if !metricNameRegexp.MatchString(column) {
+			return fmt.Errorf("Query %s column '%s' must be made of letters, digits and underscores", q.Name, column)
+		}
+		if _, ok := q.columns[column]; ok {
+			return fmt.Errorf("Query %s column %s is defined more than once", q.Name, column)
+		}
+		q.columns[column] = i
+	}
+	for _, label := range q.Labels {
+		if _, ok := q.columns[label]; !ok {
+			return fmt.Errorf("Query %s label %s is not one of the query columns", q.Name, label)
+		}
+	}
+	metrics := make(map[string]bool)
+	for _, value := range q.Values {
+		if _, ok := q.columns[value.Column]; !ok {
+			return fmt.Errorf("Query %s value %s is not one of the query columns", q.Name, value.Column)
+		}
+		if value.Metric == "" {
+			value.Metric = value.Column
+		} else if !metricNameRegexp.MatchString(value.Metric) {
+			return fmt.Errorf("Query %s value %s metric '%s' must be made of letters, digits and underscores", q.Name, value.Column, value.Metric)
+		}
+		if metrics[value.Metric] {
+			return fmt.Errorf("Query %s metric %s is defined more than once", q.Name, value.Metric)
+		}
+		metrics[value.Metric] = true
+		if value.Type == "" {
+			value.Type = ValueGauge
+		} else if !sliceContains(valueTypes, value.Type) {
+			return fmt.Errorf("Query %s value %s has invalid 'type' value %s, must be one of 'gauge', 'counter', 'timestamp', 'mb_to_bytes' or 'percent_to_ratio'", q.Name, value.Column, value.Type)
+		}
+		if value.Help == "" {
+			value.Help = fmt.Sprintf("Value of column %s from query %s", value.Column, q.Name)
+		}
+	}
+	for _, target := range q.Targets {
+		if _, ok := targets[target]; !ok {
+			return fmt.Errorf("Query %s target %s is not defined", q.Name, target)
+		}
+	}
+	return nil
+}
+
+func sliceContains(slice []string, str string) bool {
+	for _, s := range slice {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+)
+
+func TestReloadConfigQueries(t *testing.T) {
+	sc := &SafeConfig{}
+	if err := sc.ReloadConfig("testdata/queries.yaml"); err != nil {
+		t.Fatalf("Unexpected err: %s", err.Error())
+	}
+	if len(sc.C.Queries) != 2 {
+		t.Fatalf("Unexpected number of queries: %d", len(sc.C.Queries))
+	}
+	query := sc.C.Queries[0]
+	if query.Timeout != defaultQueryTimeout {
+		t.Errorf("Unexpected timeout %d", query.Timeout)
+	}
+	if query.ColumnIndex("files") != 3 {
+		t.Errorf("Unexpected column index %d", query.ColumnIndex("files"))
+	}
+	files := query.Values[1]
+	if files.Metric != "files" || files.Type != ValueGauge || files.Help == "" {
+		t.Errorf("Unexpected value defaults: %+v", files)
+	}
+	if n := len(sc.C.Targets["tsm1.example.com"].Queries); n != 1 {
+		t.Errorf("Unexpected number of queries for tsm1.example.com: %d", n)
+	}
+	if n := len(sc.C.Targets["tsm2.example.com"].Queries); n != 2 {
+		t.Errorf("Unexpected number of queries for tsm2.example.com: %d", n)
+	}
+	if timeout := sc.C.Queries[1].Timeout; timeout != 5 {
+		t.Errorf("Unexpected timeout %d", timeout)
+	}
+}
+
+func TestReloadConfigBadQueries(t *testing.T) {
+	sc := &SafeConfig{}
+	tests := []struct {
+		ConfigFile    string
+		ExpectedError string
+	}{
+		{
+			ConfigFile:    "testdata/queries-invalid-type.yaml",
+			ExpectedError: "Query sessions value count has invalid 'type' value foo, must be one of 'gauge', 'counter', 'timestamp', 'mb_to_bytes' or 'percent_to_ratio'",
+		},
+		{
+			ConfigFile:    "testdata/queries-unknown-column.yaml",
+			ExpectedError: "Query sessions label node_name is not one of the query columns",
+		},
+		{
+			ConfigFile:    "testdata/queries-unknown-target.yaml",
+			ExpectedError: "Query sessions target tsm3.example.com is not defined",
+		},
+		{
+			ConfigFile:    "testdata/queries-collector-name.yaml",
+			ExpectedError: "Query volumes has the same name as a collector",
+		},
+		{
+			ConfigFile:    "testdata/queries-duplicate.yaml",
+			ExpectedError: "Query sessions is defined more than once",
+		},
+	}
+	for i, test := range tests {
+		err := sc.ReloadConfig(test.ConfigFile)
+		if err == nil {
+			t.Errorf("In case %v:\nExpected:\n%v\nGot:\nnil", i, test.ExpectedError)
+			continue
+		}
+		if err.Error() != test.ExpectedError {
+			t.Errorf("In case %v:\nExpected:\n%v\nGot:\n%v", i, test.ExpectedError, err.Error())
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// RefreshSchedule defines when a collector is refreshed in the background,
+// either on a fixed interval or a cron expression
+type RefreshSchedule struct {
+	Spec     string
+	interval time.Duration
+	cron     cron.Schedule
+}
+
+func parseRefreshSchedule(spec string) (*RefreshSchedule, error) {
+	if interval, err := time.ParseDuration(spec); err == nil {
+		if interval <= 0 {
+			return nil, fmt.Errorf("interval must be greater than 0")
+		}
+		return &RefreshSchedule{Spec: spec, interval: interval}, nil
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("must be a duration or cron expression: %s", err)
+	}
+	return &RefreshSchedule{Spec: spec, cron: schedule}, nil
+}
+
+// Next returns the next time to refresh after t
+func (s *RefreshSchedule) Next(t time.Time) time.Time {
+	if s.cron != nil {
+		return s.cron.Next(t)
+	}
+	return t.Add(s.interval)
+}
+
+// resolveRefresh merges the global refresh schedules with the target's schedules, the target's take precedence
+func (t *Target) resolveRefresh(global map[string]string) error {
+	specs := make(map[string]string)
+	for collector, spec := range global {
+		specs[collector] = spec
+	}
+	for collector, spec := range t.Refresh {
+		specs[collector] = spec
+	}
+	if len(specs) == 0 {
+		return nil
+	}
+	t.RefreshSchedules = make(map[string]*RefreshSchedule)
+	for collector, spec := range specs {
+		schedule, err := parseRefreshSchedule(spec)
+		if err != nil {
+			return fmt.Errorf("Target %s has invalid 'refresh' value '%s' for collector %s: %s", t.Name, spec, collector, err)
+		}
+		t.RefreshSchedules[collector] = schedule
+	}
+	return nil
+}
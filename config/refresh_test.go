@@ -0,0 +1,67 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReloadConfigRefresh(t *testing.T) {
+	sc := &SafeConfig{}
+	if err := sc.ReloadConfig("testdata/refresh.yaml"); err != nil {
+		t.Fatalf("Unexpected err: %s", err.Error())
+	}
+	now := time.Date(2020, 3, 22, 12, 30, 0, 0, time.Local)
+	tsm1 := sc.C.Targets["tsm1.example.com"].RefreshSchedules
+	if next := tsm1["status"].Next(now); !next.Equal(now.Add(time.Minute)) {
+		t.Errorf("Unexpected next status refresh %s", next)
+	}
+	if next := tsm1["occupancy"].Next(now); !next.Equal(now.Add(6 * time.Hour)) {
+		t.Errorf("Unexpected next occupancy refresh %s", next)
+	}
+	tsm2 := sc.C.Targets["tsm2.example.com"].RefreshSchedules
+	if next := tsm2["occupancy"].Next(now); !next.Equal(time.Date(2020, 3, 23, 2, 0, 0, 0, time.Local)) {
+		t.Errorf("Unexpected next occupancy refresh %s", next)
+	}
+}
+
+func TestReloadConfigRefreshInvalid(t *testing.T) {
+	sc := &SafeConfig{}
+	err := sc.ReloadConfig("testdata/refresh-invalid.yaml")
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	if !strings.HasPrefix(err.Error(), "Target tsm1.example.com has invalid 'refresh' value 'nightly' for collector occupancy: must be a duration or cron expression") {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestReloadConfigRefreshUnknown(t *testing.T) {
+	sc := &SafeConfig{}
+	err := sc.ReloadConfig("testdata/refresh-unknown.yaml")
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	if err.Error() != "Configuration has unknown collector ocupancy in 'refresh'" {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestParseRefreshScheduleNegative(t *testing.T) {
+	if _, err := parseRefreshSchedule("-1m"); err == nil {
+		t.Errorf("Expected error")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/treydock/tsm_exporter/collector"
+)
+
+var (
+	errQueueTimeout = errors.New("Timeout waiting for a scrape of the same target")
+)
+
+// scrapeGroup shares the result of one collection between concurrent scrapes of the same target and collectors
+type scrapeGroup struct {
+	sync.Mutex
+	flights map[string]*scrapeFlight
+	running sync.WaitGroup
+}
+
+type scrapeFlight struct {
+	key     string
+	done    chan struct{}
+	mfs     []*dto.MetricFamily
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func newScrapeGroup() *scrapeGroup {
+	return &scrapeGroup{flights: make(map[string]*scrapeFlight)}
+}
+
+// do runs gather unless a scrape with the same key is in flight, in which case it waits up to
+// queueTimeout for that scrape's result. A queueTimeout of 0 waits until the scrape finishes.
+// cancel cancels the context of the collectors run by gather, it is called once gather returns or
+// every scrape waiting for the result is done, and right away if an existing scrape is joined.
+// Returns errQueueTimeout if the wait timed out and the error of ctx if ctx is done first.
+func (g *scrapeGroup) do(ctx context.Context, key string, queueTimeout time.Duration, cancel context.CancelFunc, gather func() ([]*dto.MetricFamily, error)) ([]*dto.MetricFamily, error) {
+	g.Lock()
+	if flight, ok := g.flights[key]; ok {
+		flight.waiters++
+		g.Unlock()
+		cancel()
+		return g.wait(ctx, flight, queueTimeout)
+	}
+	flight := &scrapeFlight{key: key, done: make(chan struct{}), waiters: 1, cancel: cancel}
+	// Counted before the flight can be joined so that drain waits for it
+	g.running.Add(1)
+	g.flights[key] = flight
+	g.Unlock()
+
+	go func() {
+		defer g.running.Done()
+		flight.mfs, flight.err = gather()
+		g.Lock()
+		if g.flights[key] == flight {
+			delete(g.flights, key)
+		}
+		g.Unlock()
+		cancel()
+		close(flight.done)
+	}()
+	return g.wait(ctx, flight, 0)
+}
+
+func (g *scrapeGroup) wait(ctx context.Context, flight *scrapeFlight, queueTimeout time.Duration) ([]*dto.MetricFamily, error) {
+	var timeout <-chan time.Time
+	if queueTimeout > 0 {
+		timer := time.NewTimer(queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-flight.done:
+		return flight.mfs, flight.err
+	case <-timeout:
+		g.leave(flight)
+		return nil, errQueueTimeout
+	case <-ctx.Done():
+		g.leave(flight)
+		return nil, ctx.Err()
+	}
+}
+
+// drain waits for running collections to finish
+func (g *scrapeGroup) drain() {
+	g.running.Wait()
+}
+
+// leave removes a waiting scrape, the collection is canceled once no scrape is waiting for its result
+func (g *scrapeGroup) leave(flight *scrapeFlight) {
+	g.Lock()
+	defer g.Unlock()
+	flight.waiters--
+	if flight.waiters > 0 {
+		return
+	}
+	if g.flights[flight.key] == flight {
+		delete(g.flights, flight.key)
+	}
+	flight.cancel()
+}
+
+// scrapeDeadline returns the deadline of a scrape from the Prometheus scrape timeout header less the
+// --web.scrape-timeout-offset, or the zero time if the header is not set
+func scrapeDeadline(r *http.Request) (time.Time, error) {
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if header == "" {
+		return time.Time{}, nil
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}, fmt.Errorf("Failed to parse timeout from Prometheus header %s", header)
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if *scrapeTimeoutOffset < timeout {
+		timeout -= *scrapeTimeoutOffset
+	}
+	return time.Now().Add(timeout), nil
+}
+
+// newScrapeContext returns the context of the collectors run by a scrape, not derived from the request
+// so that a collection shared by several scrapes is not canceled when the first client disconnects
+func newScrapeContext(deadline time.Time) (context.Context, context.CancelFunc) {
+	if deadline.IsZero() {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithDeadline(context.Background(), deadline)
+}
+
+// scrapeKey identifies scrapes that produce the same result
+func scrapeKey(endpoint string, target string, module string, tsmCollector *collector.TSMCollector) string {
+	names := make([]string, 0, len(tsmCollector.Collectors))
+	for name := range tsmCollector.Collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join([]string{endpoint, target, module, strings.Join(names, ",")}, "|")
+}
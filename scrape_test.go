@@ -0,0 +1,152 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/treydock/tsm_exporter/collector"
+)
+
+func TestScrapeGroup(t *testing.T) {
+	g := newScrapeGroup()
+	var calls int32
+	release := make(chan struct{})
+	gather := func() ([]*dto.MetricFamily, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		name := "tsm_up"
+		return []*dto.MetricFamily{{Name: &name}}, nil
+	}
+	var wg sync.WaitGroup
+	results := make([][]*dto.MetricFamily, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = g.do(context.Background(), "tsm1", 0, func() {}, gather)
+		}(i)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := g.do(context.Background(), "tsm1", 10*time.Millisecond, func() {}, gather); err != errQueueTimeout {
+		t.Errorf("Expected queue timeout, got %v", err)
+	}
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Unexpected number of collections %d, expected 1", n)
+	}
+	for i, mfs := range results {
+		if len(mfs) != 1 || mfs[0].GetName() != "tsm_up" {
+			t.Errorf("Unexpected result %d: %v", i, mfs)
+		}
+	}
+	if _, err := g.do(context.Background(), "tsm1", 0, func() {}, gather); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Unexpected number of collections %d, expected 2", n)
+	}
+}
+
+func TestScrapeGroupCancel(t *testing.T) {
+	g := newScrapeGroup()
+	scrapeCtx, cancel := context.WithCancel(context.Background())
+	gather := func() ([]*dto.MetricFamily, error) {
+		<-scrapeCtx.Done()
+		return nil, scrapeCtx.Err()
+	}
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, err := g.do(ctx1, "tsm1", 0, cancel, gather)
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		_, err := g.do(ctx2, "tsm1", 0, func() {}, gather)
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel1()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Expected canceled, got %v", err)
+	}
+	if scrapeCtx.Err() != nil {
+		t.Errorf("Scrape canceled while another scrape is waiting")
+	}
+	cancel2()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Expected canceled, got %v", err)
+	}
+	<-scrapeCtx.Done()
+}
+
+func TestScrapeGroupDrain(t *testing.T) {
+	g := newScrapeGroup()
+	var finished int32
+	gather := func() ([]*dto.MetricFamily, error) {
+		time.Sleep(100 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+		return nil, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.do(ctx, "tsm1", 0, func() {}, gather); err != context.Canceled {
+		t.Errorf("Expected canceled, got %v", err)
+	}
+	g.drain()
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Errorf("Drain returned before the collection finished")
+	}
+}
+
+func TestScrapeDeadline(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/tsm", nil)
+	if deadline, err := scrapeDeadline(r); err != nil || !deadline.IsZero() {
+		t.Errorf("Unexpected deadline %v: %v", deadline, err)
+	}
+	r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "10")
+	deadline, err := scrapeDeadline(r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if timeout := time.Until(deadline); timeout > 9500*time.Millisecond || timeout < 9*time.Second {
+		t.Errorf("Unexpected timeout %v", timeout)
+	}
+	r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "0.2")
+	deadline, _ = scrapeDeadline(r)
+	if timeout := time.Until(deadline); timeout > 200*time.Millisecond || timeout < 100*time.Millisecond {
+		t.Errorf("Unexpected timeout %v", timeout)
+	}
+	r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "foo")
+	if _, err := scrapeDeadline(r); err == nil {
+		t.Errorf("Expected error")
+	}
+}
+
+func TestScrapeKey(t *testing.T) {
+	c := &collector.TSMCollector{Collectors: map[string]collector.Collector{"volumes": nil, "db": nil}}
+	if key := scrapeKey(tsmEndpoint, "tsm1", "nightly", c); key != "/tsm|tsm1|nightly|db,volumes" {
+		t.Errorf("Unexpected key %s", key)
+	}
+}
@@ -14,15 +14,23 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/promlog/flag"
 	"github.com/prometheus/common/version"
@@ -31,58 +39,350 @@ import (
 )
 
 const (
-	tsmEndpoint     = "/tsm"
-	metricsEndpoint = "/metrics"
+	tsmEndpoint        = "/tsm"
+	allTargetsEndpoint = "/tsm/all"
+	sdEndpoint         = "/sd"
+	metricsEndpoint    = "/metrics"
+	reloadEndpoint     = "/-/reload"
+	// Reasons for tsm_up 0 in addition to the connectivity check reasons of the collector package
+	reasonCollectorFailed = "collector_failed"
+	reasonQueueTimeout    = "queue_timeout"
 )
 
 var (
-	configFile    = kingpin.Flag("config.file", "Path to exporter config file").Default("tsm_exporter.yaml").String()
-	listenAddress = kingpin.Flag("web.listen-address", "Address to listen on for web interface and telemetry.").Default(":9310").String()
+	configFile          = kingpin.Flag("config.file", "Path to exporter config file").Default("tsm_exporter.yaml").String()
+	listenAddress       = kingpin.Flag("web.listen-address", "Address to listen on for web interface and telemetry.").Default(":9310").String()
+	watchInterval       = kingpin.Flag("config.watch-interval", "Interval to check config file for changes and reload, 0 disables").Default("0s").Duration()
+	maxTargets          = kingpin.Flag("web.max-concurrent-targets", "Maximum number of targets scraped in parallel by "+allTargetsEndpoint).Default("5").Int()
+	scrapeTimeoutOffset = kingpin.Flag("web.scrape-timeout-offset", "Offset to subtract from the Prometheus scrape timeout so collectors finish before Prometheus gives up").Default("500ms").Duration()
+	shutdownGracePeriod = kingpin.Flag("web.shutdown-grace-period", "Time to wait for in-flight scrapes to finish when stopping the exporter before canceling them").Default("30s").Duration()
+	queueTimeout        = kingpin.Flag("web.queue-timeout", "Maximum time to wait for an in progress scrape of the same target before returning 503, 0 waits until the scrape finishes").Default("2m").Duration()
 )
 
-func metricsHandler(config *config.Config, logger log.Logger) http.HandlerFunc {
+func metricsHandler(sc *config.SafeConfig, scheduler *collector.Scheduler, scrapes *scrapeGroup, logger log.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		registry := prometheus.NewRegistry()
-
 		t := r.URL.Query().Get("target")
 		if t == "" {
 			http.Error(w, "'target' parameter must be specified", http.StatusBadRequest)
 			return
 		}
-		target, ok := config.Targets[t]
+		m := r.URL.Query().Get("module")
+		sc.RLock()
+		c := sc.C
+		sc.RUnlock()
+		target, ok := c.Target(t)
+		_, moduleOk := c.Modules[m]
 		if !ok {
 			http.Error(w, fmt.Sprintf("Unknown target %s", t), http.StatusNotFound)
 			return
 		}
+		if m != "" && !moduleOk {
+			http.Error(w, fmt.Sprintf("Unknown module %s", m), http.StatusBadRequest)
+			return
+		}
+		queryTarget := target
+		if m != "" {
+			queryTarget = c.ModuleTarget(target, m)
+		}
+
+		collect := r.URL.Query()["collect[]"]
+		exclude := r.URL.Query()["exclude[]"]
+		if err := collector.CheckCollectorNames(queryTarget, append(collect, exclude...)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		deadline, err := scrapeDeadline(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := newScrapeContext(deadline)
+		tsmCollector := collector.NewCollector(ctx, queryTarget, logger)
+		tsmCollector.Filter(collect, exclude)
+		if m == "" {
+			scheduler.Cached(target, tsmCollector)
+		}
+		// Concurrent scrapes of the same target and collectors share one collection
+		key := scrapeKey(tsmEndpoint, target.Name, m, tsmCollector)
+		mfs, err := scrapes.do(r.Context(), key, *queueTimeout, cancel, func() ([]*dto.MetricFamily, error) {
+			return gatherCollectors(ctx, queryTarget, tsmCollector, nil, logger)
+		})
+		if err == errQueueTimeout {
+			level.Error(logger).Log("msg", "Timeout waiting for scrape in progress", "target", target.Name)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if r.Context().Err() != nil {
+			level.Debug(logger).Log("msg", "Client disconnected before scrape finished", "target", target.Name)
+			return
+		}
+
+		gatherers := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return mfs, err })
+
+		// Delegate http serving to Prometheus client library
+		h := promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
+		h.ServeHTTP(w, r)
+	}
+}
 
-		target.Lock()
-		tsmCollector := collector.NewCollector(target, logger)
-		defer target.Unlock()
-		for key, collector := range tsmCollector.Collectors {
-			level.Debug(logger).Log("msg", fmt.Sprintf("Enabled collector %s", key))
-			registry.MustRegister(collector)
+func allTargetsHandler(sc *config.SafeConfig, scheduler *collector.Scheduler, scrapes *scrapeGroup, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deadline, err := scrapeDeadline(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sc.RLock()
+		targets := make([]*config.Target, 0, len(sc.C.Targets))
+		for _, target := range sc.C.Targets {
+			targets = append(targets, target)
 		}
+		sc.RUnlock()
+		sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
 
-		gatherers := prometheus.Gatherers{registry}
+		limit := *maxTargets
+		if limit < 1 {
+			limit = 1
+		}
+		sem := make(chan struct{}, limit)
+		gatherers := make(prometheus.Gatherers, len(targets))
+		var wg sync.WaitGroup
+		for i, target := range targets {
+			wg.Add(1)
+			go func(i int, target *config.Target) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				gatherers[i] = gatherTarget(r.Context(), deadline, target, scheduler, scrapes, log.With(logger, "target", target.Name))
+			}(i, target)
+		}
+		wg.Wait()
+		if r.Context().Err() != nil {
+			level.Debug(logger).Log("msg", "Client disconnected before scrape finished")
+			return
+		}
 
-		// Delegate http serving to Prometheus client library, which will call collector.Collect.
 		h := promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
 		h.ServeHTTP(w, r)
 	}
 }
 
+// gatherTarget collects the metrics of one target with a server label added, errors are isolated to the target and reported with tsm_up.
+// Collection is canceled when ctx is done and collectors finish by the deadline if it is not zero.
+func gatherTarget(ctx context.Context, deadline time.Time, target *config.Target, scheduler *collector.Scheduler, scrapes *scrapeGroup, logger log.Logger) prometheus.Gatherer {
+	labels := prometheus.Labels{"server": target.Name}
+	scrapeCtx, cancel := newScrapeContext(deadline)
+	tsmCollector := collector.NewCollector(scrapeCtx, target, logger)
+	scheduler.Cached(target, tsmCollector)
+	key := scrapeKey(allTargetsEndpoint, target.Name, "", tsmCollector)
+	mfs, err := scrapes.do(ctx, key, *queueTimeout, cancel, func() ([]*dto.MetricFamily, error) {
+		return gatherCollectors(scrapeCtx, target, tsmCollector, labels, logger)
+	})
+	if err == errQueueTimeout {
+		level.Error(logger).Log("msg", "Timeout waiting for scrape in progress")
+		return upGatherer(labels, reasonQueueTimeout)
+	} else if err != nil {
+		level.Error(logger).Log("msg", "Error collecting target", "err", err)
+		if mfs == nil {
+			return upGatherer(labels, collector.ReasonError)
+		}
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return mfs, nil })
+}
+
+// gatherCollectors runs the collectors of a target, skipping those that query the TSM server when it is unreachable, and adds tsm_up,
+// labels are added to every metric
+func gatherCollectors(ctx context.Context, target *config.Target, tsmCollector *collector.TSMCollector, labels prometheus.Labels, logger log.Logger) ([]*dto.MetricFamily, error) {
+	registry := prometheus.NewRegistry()
+	registerer := prometheus.WrapRegistererWith(labels, registry)
+	reason := tsmCollector.Gate(ctx, target, logger)
+	for key, c := range tsmCollector.Collectors {
+		level.Debug(logger).Log("msg", fmt.Sprintf("Enabled collector %s", key))
+		registerer.MustRegister(c)
+	}
+	mfs, err := registry.Gather()
+	if reason == "" && (err != nil || collectFailed(mfs)) {
+		reason = reasonCollectorFailed
+	}
+	return prometheus.Gatherers{
+		prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return mfs, err }),
+		upGatherer(labels, reason),
+	}.Gather()
+}
+
+// upGatherer returns tsm_up, which is 1 if there is no reason the target is down
+func upGatherer(labels prometheus.Labels, reason string) prometheus.Gatherer {
+	up := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "tsm_up",
+		Help:        "Indicates the TSM server is reachable and all collectors succeeded, reason is why not",
+		ConstLabels: labels,
+	}, []string{"reason"})
+	value := 0.0
+	if reason == "" {
+		value = 1
+	}
+	up.WithLabelValues(reason).Set(value)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(up)
+	return registry
+}
+
+// collectFailed checks if any collector reported an error or timeout
+func collectFailed(mfs []*dto.MetricFamily) bool {
+	for _, mf := range mfs {
+		if mf.GetName() != "tsm_exporter_collect_error" && mf.GetName() != "tsm_exporter_collect_timeout" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if m.GetGauge().GetValue() != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type sdTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// sdHandler returns the targets in the Prometheus HTTP service discovery format,
+// query parameters filter the targets by label, multiple values of a label match any of the values
+func sdHandler(sc *config.SafeConfig, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filters := r.URL.Query()
+		groups := []sdTargetGroup{}
+		sc.RLock()
+		for name, target := range sc.C.Targets {
+			labels := target.DiscoveryLabels()
+			match := true
+			for label, values := range filters {
+				if value, ok := labels[label]; !ok || !sliceContains(values, value) {
+					match = false
+					break
+				}
+			}
+			if match {
+				groups = append(groups, sdTargetGroup{Targets: []string{name}, Labels: labels})
+			}
+		}
+		sc.RUnlock()
+		sort.Slice(groups, func(i, j int) bool { return groups[i].Targets[0] < groups[j].Targets[0] })
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(groups); err != nil {
+			level.Error(logger).Log("msg", "Error encoding service discovery response", "err", err)
+		}
+	}
+}
+
+func sliceContains(slice []string, str string) bool {
+	for _, s := range slice {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+func reloadHandler(reloadCh chan<- chan error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "This endpoint requires a POST request", http.StatusMethodNotAllowed)
+			return
+		}
+		rc := make(chan error)
+		reloadCh <- rc
+		if err := <-rc; err != nil {
+			http.Error(w, fmt.Sprintf("Failed to reload config: %s", err), http.StatusInternalServerError)
+		}
+	}
+}
+
+func configModTime(configFile string) time.Time {
+	info, err := os.Stat(configFile)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func reloadConfig(sc *config.SafeConfig, scheduler *collector.Scheduler, reloadCh <-chan chan error, logger log.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	var watch <-chan time.Time
+	if *watchInterval > 0 {
+		ticker := time.NewTicker(*watchInterval)
+		defer ticker.Stop()
+		watch = ticker.C
+	}
+	lastModTime := configModTime(*configFile)
+	reload := func(reason string) error {
+		lastModTime = configModTime(*configFile)
+		sc.RLock()
+		names := sc.C.TargetNames()
+		sc.RUnlock()
+		if err := sc.ReloadConfig(*configFile); err != nil {
+			level.Error(logger).Log("msg", "Error reloading config", "reason", reason, "err", err)
+			return err
+		}
+		level.Info(logger).Log("msg", "Reloaded config file", "reason", reason)
+		sc.RLock()
+		scheduler.Update(sc.C.Targets)
+		dropped := droppedTargets(sc.C, names)
+		sc.RUnlock()
+		for _, name := range dropped {
+			level.Debug(logger).Log("msg", "Removing state of target no longer defined", "target", name)
+			collector.ForgetTarget(name)
+		}
+		return nil
+	}
+	for {
+		select {
+		case <-hup:
+			_ = reload("signal")
+		case rc := <-reloadCh:
+			rc <- reload("http")
+		case <-watch:
+			if modTime := configModTime(*configFile); !modTime.Equal(lastModTime) {
+				_ = reload("watch")
+			}
+		}
+	}
+}
+
+// droppedTargets returns the target names not defined by c, targets resolved from patterns
+// are included as they are resolved again on their next scrape
+func droppedTargets(c *config.Config, names []string) []string {
+	var dropped []string
+	for _, name := range names {
+		if _, ok := c.Targets[name]; !ok {
+			dropped = append(dropped, name)
+		}
+	}
+	return dropped
+}
+
 func run(logger log.Logger) {
 	level.Info(logger).Log("msg", "Starting tsm_exporter", "version", version.Info())
 	level.Info(logger).Log("msg", "Build context", "build_context", version.BuildContext())
 	level.Info(logger).Log("msg", "Starting Server", "address", *listenAddress)
 
-	sc := &config.SafeConfig{}
+	sc := &config.SafeConfig{Evicted: collector.ForgetTarget}
 
 	if err := sc.ReloadConfig(*configFile); err != nil {
 		level.Error(logger).Log("msg", "Error loading config", "err", err)
 		os.Exit(1)
 	}
 
+	scheduler := collector.NewScheduler(logger)
+	scheduler.Update(sc.C.Targets)
+
+	reloadCh := make(chan chan error)
+	go reloadConfig(sc, scheduler, reloadCh, logger)
+
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		//nolint:errcheck
 		w.Write([]byte(`<html>
@@ -90,17 +390,47 @@ func run(logger log.Logger) {
              <body>
              <h1>TSM Exporter</h1>
              <p><a href='` + tsmEndpoint + `'>TSM Metrics</a></p>
+             <p><a href='` + allTargetsEndpoint + `'>TSM Metrics for all targets</a></p>
+             <p><a href='` + sdEndpoint + `'>Service Discovery</a></p>
              <p><a href='` + metricsEndpoint + `'>Exporter Metrics</a></p>
              </body>
              </html>`))
 	})
-	http.Handle(tsmEndpoint, metricsHandler(sc.C, logger))
+	scrapes := newScrapeGroup()
+	http.Handle(tsmEndpoint, metricsHandler(sc, scheduler, scrapes, logger))
+	http.Handle(allTargetsEndpoint, allTargetsHandler(sc, scheduler, scrapes, logger))
+	http.Handle(sdEndpoint, sdHandler(sc, logger))
+	http.Handle(reloadEndpoint, reloadHandler(reloadCh))
 	http.Handle(metricsEndpoint, promhttp.Handler())
-	err := http.ListenAndServe(*listenAddress, nil)
-	if err != nil {
+	server := &http.Server{Addr: *listenAddress}
+	drained := make(chan struct{})
+	go drainOnSignal(server, scrapes, drained, logger)
+	err := server.ListenAndServe()
+	if err != http.ErrServerClosed {
 		level.Error(logger).Log("err", err)
 		os.Exit(1)
 	}
+	<-drained
+	scheduler.Stop()
+	collector.ClosePools()
+	level.Info(logger).Log("msg", "Stopped tsm_exporter")
+}
+
+// drainOnSignal stops accepting scrapes on SIGTERM or interrupt and waits up to --web.shutdown-grace-period
+// for in-flight scrapes to finish, scrapes still running are then canceled which terminates their dsmadmc processes
+func drainOnSignal(server *http.Server, scrapes *scrapeGroup, drained chan<- struct{}, logger log.Logger) {
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM, os.Interrupt)
+	sig := <-term
+	level.Info(logger).Log("msg", "Draining in-flight scrapes", "signal", sig, "grace_period", *shutdownGracePeriod)
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownGracePeriod)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		level.Warn(logger).Log("msg", "In-flight scrapes did not finish within the grace period, canceling", "err", err)
+		_ = server.Close()
+		scrapes.drain()
+	}
+	close(drained)
 }
 
 func main() {
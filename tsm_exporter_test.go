@@ -19,7 +19,9 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -77,6 +79,9 @@ func TestMain(m *testing.M) {
 		fmt.Printf("ERROR parsing arguments %s", err)
 		os.Exit(1)
 	}
+	collector.DsmadmcProbeExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return "TSM_EXPORTER_PROBE", nil
+	}
 	w := log.NewSyncWriter(os.Stderr)
 	logger := log.NewLogfmtLogger(w)
 	go func() {
@@ -166,6 +171,218 @@ func TestMetricsHandlerCollectorsDefined(t *testing.T) {
 	}
 }
 
+func TestMetricsHandlerCollect(t *testing.T) {
+	collector.DsmadmcLogExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return mockedLogStdout, nil
+	}
+	collector.DsmadmcDBExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return mockedDBStdout, nil
+	}
+	body, err := queryExporter("target=tsm1.example.com&collect[]=log&collect[]=db&exclude[]=db", http.StatusOK)
+	if err != nil {
+		t.Fatalf("Unexpected error GET /tsm: %s", err.Error())
+	}
+	if !strings.Contains(body, "tsm_exporter_collect_error{collector=\"log\"} 0") {
+		t.Errorf("Unexpected value for tsm_exporter_collect_error")
+	}
+	if strings.Contains(body, "collector=\"db\"") || strings.Contains(body, "collector=\"volumes\"") {
+		t.Errorf("Should only contain log collector metrics")
+	}
+	if !strings.Contains(body, "tsm_up{reason=\"\"} 1") {
+		t.Errorf("Unexpected value for tsm_up:\n%s", body)
+	}
+}
+
+func TestMetricsHandlerCollectUnknown(t *testing.T) {
+	body, err := queryExporter("target=tsm1.example.com&collect[]=log&exclude[]=dne", http.StatusBadRequest)
+	if err != nil {
+		t.Fatalf("Unexpected error GET /tsm: %s", err.Error())
+	}
+	if !strings.Contains(body, "Unknown collector dne, valid collectors are: db, drives, events") {
+		t.Errorf("Unexpected body: %s", body)
+	}
+}
+
+func TestMetricsHandlerModule(t *testing.T) {
+	collector.DsmadmcLogExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return mockedLogStdout, nil
+	}
+	body, err := queryExporter("target=tsm1.example.com&module=nightly", http.StatusOK)
+	if err != nil {
+		t.Fatalf("Unexpected error GET /tsm: %s", err.Error())
+	}
+	if !strings.Contains(body, "tsm_exporter_collect_error{collector=\"log\"} 0") {
+		t.Errorf("Unexpected value for tsm_exporter_collect_error")
+	}
+	if strings.Contains(body, "collector=\"volumes\"") {
+		t.Errorf("Should only contain log collector metrics")
+	}
+	body, err = queryExporter("target=tsm1.example.com&module=dne", http.StatusBadRequest)
+	if err != nil {
+		t.Fatalf("Unexpected error GET /tsm: %s", err.Error())
+	}
+	if !strings.Contains(body, "Unknown module dne") {
+		t.Errorf("Unexpected body: %s", body)
+	}
+}
+
+func TestMetricsHandlerTargetPattern(t *testing.T) {
+	collector.DsmadmcLogExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		if target.Servername != "tsm41.example.org" {
+			return "", fmt.Errorf("Unexpected servername %s", target.Servername)
+		}
+		return mockedLogStdout, nil
+	}
+	body, err := queryExporter("target=tsm41.example.org", http.StatusOK)
+	if err != nil {
+		t.Fatalf("Unexpected error GET /tsm: %s", err.Error())
+	}
+	if !strings.Contains(body, "tsm_exporter_collect_error{collector=\"log\"} 0") {
+		t.Errorf("Unexpected value for tsm_exporter_collect_error")
+	}
+	_, _ = queryExporter("target=backup1.example.org", http.StatusNotFound)
+}
+
+func TestMetricsHandlerSharedScrape(t *testing.T) {
+	var calls int32
+	collector.DsmadmcVolumesExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(200 * time.Millisecond)
+		return mockVolumeStdout, nil
+	}
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			body, err := queryExporter("target=tsm2.example.com", http.StatusOK)
+			if err == nil && !strings.Contains(body, "tsm_exporter_collect_error{collector=\"volumes\"} 0") {
+				err = fmt.Errorf("Unexpected body: %s", body)
+			}
+			errs <- err
+		}()
+		time.Sleep(50 * time.Millisecond)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Unexpected error GET /tsm: %s", err.Error())
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Unexpected number of queries %d, expected 1", n)
+	}
+}
+
+func TestMetricsHandlerQueueTimeout(t *testing.T) {
+	collector.DsmadmcVolumesExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		time.Sleep(300 * time.Millisecond)
+		return mockVolumeStdout, nil
+	}
+	timeout := *queueTimeout
+	*queueTimeout = 50 * time.Millisecond
+	defer func() { *queueTimeout = timeout }()
+	done := make(chan error, 1)
+	go func() {
+		_, err := queryExporter("target=tsm2.example.com", http.StatusOK)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	body, err := queryExporter("target=tsm2.example.com", http.StatusServiceUnavailable)
+	if err != nil {
+		t.Errorf("Unexpected error GET /tsm: %s", err.Error())
+	} else if !strings.Contains(body, "Timeout waiting for a scrape of the same target") {
+		t.Errorf("Unexpected body: %s", body)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error GET /tsm: %s", err.Error())
+	}
+}
+
+func TestMetricsHandlerScrapeTimeout(t *testing.T) {
+	collector.DsmadmcVolumesExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/tsm?target=tsm2.example.com", address), nil)
+	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "1")
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error GET /tsm: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("Scrape took %v, longer than the scrape timeout less the offset", elapsed)
+	}
+	if !strings.Contains(string(body), "tsm_exporter_collect_timeout{collector=\"volumes\"} 1") {
+		t.Errorf("Unexpected body: %s", body)
+	}
+	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "foo")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error GET /tsm: %s", err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Unexpected status code %d", resp.StatusCode)
+	}
+}
+
+func TestMetricsHandlerClientDisconnect(t *testing.T) {
+	canceled := make(chan error, 1)
+	collector.DsmadmcVolumesExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		<-ctx.Done()
+		canceled <- ctx.Err()
+		return "", ctx.Err()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/tsm?target=tsm2.example.com", address), nil)
+	if _, err := http.DefaultClient.Do(req); err == nil {
+		t.Errorf("Expected client timeout")
+	}
+	select {
+	case err := <-canceled:
+		if err != context.Canceled {
+			t.Errorf("Unexpected error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Collector was not canceled after client disconnected")
+	}
+}
+
+func TestMetricsHandlerUnreachable(t *testing.T) {
+	var calls int32
+	collector.DsmadmcProbeExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		return "", fmt.Errorf("ANS1017E Session rejected: TCP/IP connection failure.")
+	}
+	defer func() {
+		collector.DsmadmcProbeExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+			return "TSM_EXPORTER_PROBE", nil
+		}
+	}()
+	body, err := queryExporter("target=tsm51.example.org", http.StatusOK)
+	if err != nil {
+		t.Fatalf("Unexpected error GET /tsm: %s", err.Error())
+	}
+	if !strings.Contains(body, "tsm_up{reason=\"error\"} 0") {
+		t.Errorf("Unexpected value for tsm_up:\n%s", body)
+	}
+	if strings.Contains(body, "tsm_exporter_collect_error") {
+		t.Errorf("Collectors should be skipped:\n%s", body)
+	}
+	body, err = queryExporter("target=tsm51.example.org", http.StatusOK)
+	if err != nil {
+		t.Fatalf("Unexpected error GET /tsm: %s", err.Error())
+	}
+	if !strings.Contains(body, "tsm_up{reason=\"circuit_open\"} 0") {
+		t.Errorf("Unexpected value for tsm_up:\n%s", body)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Unexpected number of probes %d, expected 1", n)
+	}
+}
+
 func TestMetricsHandlerNoTarget(t *testing.T) {
 	_, _ = queryExporter("", http.StatusBadRequest)
 }
@@ -174,6 +391,148 @@ func TestMetricsHandlerBadTarget(t *testing.T) {
 	_, _ = queryExporter("target=dne", http.StatusNotFound)
 }
 
+func TestAllTargetsHandler(t *testing.T) {
+	collector.DsmadmcStatusExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return mockStatusStdout, nil
+	}
+	collector.DsmadmcVolumesExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		if target.Name == "tsm2.example.com" {
+			return "", fmt.Errorf("error")
+		}
+		return mockVolumeStdout, nil
+	}
+	collector.DsmadmcDBExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return mockedDBStdout, nil
+	}
+	collector.DsmadmcLogExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return mockedLogStdout, nil
+	}
+	collector.DsmadmcLibVolumesExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return mockLibVolumeStdout, nil
+	}
+	collector.DsmadmcDrivesExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return mockDriveStdout, nil
+	}
+	collector.DsmadmcEventsCompletedExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return mockEventCompletedStdout, nil
+	}
+	collector.DsmadmcEventsNotCompletedExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return mockEventNotCompletedStdout, nil
+	}
+	collector.DsmadmcReplicationViewExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return mockReplicationViewStdout, nil
+	}
+	collector.DsmadmcOccupancysExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return "", nil
+	}
+	collector.DsmadmcStoragePoolExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return "", nil
+	}
+	collector.DsmadmcSummaryExec = func(target *config.Target, tapeMount bool, ctx context.Context, logger log.Logger) (string, error) {
+		return "", nil
+	}
+	collector.DsmadmcVolumeUsagesExec = func(target *config.Target, ctx context.Context, logger log.Logger) (string, error) {
+		return "", nil
+	}
+	resp, err := http.Get(fmt.Sprintf("http://%s/tsm/all", address))
+	if err != nil {
+		t.Fatalf("Unexpected error GET /tsm/all: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected status code %d, expected %d", resp.StatusCode, http.StatusOK)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Unexpected error reading /tsm/all: %s", err.Error())
+	}
+	body := string(b)
+	for _, expected := range []string{
+		"tsm_up{reason=\"\",server=\"tsm1.example.com\"} 1",
+		"tsm_up{reason=\"collector_failed\",server=\"tsm2.example.com\"} 0",
+		"tsm_exporter_collect_error{collector=\"volumes\",server=\"tsm1.example.com\"} 0",
+		"tsm_exporter_collect_error{collector=\"volumes\",server=\"tsm2.example.com\"} 1",
+		"tsm_active_log_total_bytes{server=\"tsm1.example.com\"}",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected %s in body:\n%s", expected, body)
+		}
+	}
+	if strings.Contains(body, "tsm_active_log_total_bytes{server=\"tsm2.example.com\"}") {
+		t.Errorf("Should not contain tsm_active_log_total_bytes metric for tsm2.example.com")
+	}
+}
+
+func TestSDHandler(t *testing.T) {
+	tests := []struct {
+		param    string
+		expected string
+	}{
+		{"", `[{"targets":["tsm1.example.com"],"labels":{"env":"prod","library_name":"LIB1","servername":"tsm1"}},{"targets":["tsm2.example.com"],"labels":{"library_name":"LIB1","servername":"tsm1"}}]`},
+		{"env=prod", `[{"targets":["tsm1.example.com"],"labels":{"env":"prod","library_name":"LIB1","servername":"tsm1"}}]`},
+		{"servername=tsm1&env=prod&env=dev", `[{"targets":["tsm1.example.com"],"labels":{"env":"prod","library_name":"LIB1","servername":"tsm1"}}]`},
+		{"env=dev", `[]`},
+	}
+	for _, test := range tests {
+		resp, err := http.Get(fmt.Sprintf("http://%s/sd?%s", address, test.param))
+		if err != nil {
+			t.Fatalf("Unexpected error GET /sd: %s", err.Error())
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Unexpected error reading /sd: %s", err.Error())
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Unexpected content type %s", ct)
+		}
+		if strings.TrimSpace(string(body)) != test.expected {
+			t.Errorf("Unexpected body for %s\nExpected: %s\nGot: %s", test.param, test.expected, body)
+		}
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	resp, err := http.Post(fmt.Sprintf("http://%s/-/reload", address), "", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error POST /-/reload: %s", err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected status code %d, expected %d", resp.StatusCode, http.StatusOK)
+	}
+	resp, err = http.Get(fmt.Sprintf("http://%s/-/reload", address))
+	if err != nil {
+		t.Fatalf("Unexpected error GET /-/reload: %s", err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status code %d, expected %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+	resp, err = http.Get(fmt.Sprintf("http://%s/metrics", address))
+	if err != nil {
+		t.Fatalf("Unexpected error GET /metrics: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Unexpected error reading /metrics: %s", err.Error())
+	}
+	if !strings.Contains(string(body), "tsm_exporter_config_last_reload_successful 1") {
+		t.Errorf("Unexpected value for tsm_exporter_config_last_reload_successful")
+	}
+}
+
+func TestDroppedTargets(t *testing.T) {
+	c := &config.Config{Targets: map[string]*config.Target{
+		"tsm1.example.com": {Name: "tsm1.example.com"},
+	}}
+	dropped := droppedTargets(c, []string{"tsm1.example.com", "tsm2.example.com"})
+	if !reflect.DeepEqual(dropped, []string{"tsm2.example.com"}) {
+		t.Errorf("Unexpected dropped targets %v", dropped)
+	}
+}
+
 func queryExporter(param string, want int) (string, error) {
 	resp, err := http.Get(fmt.Sprintf("http://%s/tsm?%s", address, param))
 	if err != nil {